@@ -3,8 +3,14 @@ package main
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/mark3labs/mcp-go/server"
+	"github.com/mistakeknot/interserve/internal/classify"
+	"github.com/mistakeknot/interserve/internal/dispatch"
+	"github.com/mistakeknot/interserve/internal/tempfiles"
 	"github.com/mistakeknot/interserve/internal/tools"
 )
 
@@ -15,23 +21,252 @@ func main() {
 		server.WithToolCapabilities(true),
 	)
 
-	dispatchPath := os.Getenv("INTERSERVE_DISPATCH_PATH")
-	if dispatchPath == "" {
-		dispatchPath = "/root/projects/Interverse/hub/clavain/scripts/dispatch.sh"
+	limiter, err := limiterFromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "interserve-mcp: %v\n", err)
+		os.Exit(1)
+	}
+	breaker, err := breakerFromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "interserve-mcp: %v\n", err)
+		os.Exit(1)
 	}
+	ledger := dispatch.NewLedger()
 
-	if info, err := os.Stat(dispatchPath); err != nil {
-		fmt.Fprintf(os.Stderr, "interserve-mcp: dispatch path %q: %v\n", dispatchPath, err)
+	// The limiter and ledger wrap each backend, so a hedged request takes its
+	// own slot and its tokens and time are recorded.
+	d, err := newDispatcher(s, limiter.Middleware(), ledger.Middleware())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "interserve-mcp: %v\n", err)
 		os.Exit(1)
-	} else if info.IsDir() {
-		fmt.Fprintf(os.Stderr, "interserve-mcp: dispatch path %q is a directory, expected a file\n", dispatchPath)
+	}
+	if dir := strings.TrimSpace(os.Getenv("INTERSERVE_RECORD_DIR")); dir != "" {
+		d = dispatch.NewRecorder(d, dir)
+	}
+	// The breaker sits outermost so short-circuited calls never queue.
+	d = dispatch.Chain(d, breaker.Middleware())
+
+	classifyOpts, err := classifyOptionsFromEnv()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "interserve-mcp: %v\n", err)
 		os.Exit(1)
 	}
 
-	tools.RegisterAll(s, dispatchPath)
+	tools.RegisterAll(s, tools.Config{
+		Dispatcher: d,
+		Classify:   classifyOpts,
+		Ledger:     ledger,
+		Limiter:    limiter,
+		Breaker:    breaker,
+	})
 
-	if err := server.ServeStdio(s); err != nil {
+	err = server.ServeStdio(s)
+	if cleanupErr := tempfiles.Cleanup(); cleanupErr != nil {
+		fmt.Fprintf(os.Stderr, "interserve-mcp: remove rendered files: %v\n", cleanupErr)
+	}
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "interserve-mcp: %v\n", err)
 		os.Exit(1)
 	}
 }
+
+// newDispatcher builds the dispatch backend, wrapping each backend in
+// perBackend. INTERSERVE_BACKENDS (a comma-separated, ordered list) configures
+// a fallback chain and takes precedence over the single INTERSERVE_BACKEND.
+func newDispatcher(s *server.MCPServer, perBackend ...dispatch.Middleware) (dispatch.Dispatcher, error) {
+	list := strings.TrimSpace(os.Getenv("INTERSERVE_BACKENDS"))
+	if list == "" {
+		d, err := newBackend(s, strings.TrimSpace(os.Getenv("INTERSERVE_BACKEND")), true)
+		if err != nil {
+			return nil, err
+		}
+		return dispatch.Chain(d, perBackend...), nil
+	}
+
+	var backends []dispatch.Backend
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		// The chain itself falls through, so sampling needs no shell fallback of its own.
+		d, err := newBackend(s, name, false)
+		if err != nil {
+			return nil, fmt.Errorf("INTERSERVE_BACKENDS: %w", err)
+		}
+		backends = append(backends, dispatch.Backend{Name: name, Dispatcher: dispatch.Chain(d, perBackend...)})
+	}
+	if len(backends) == 0 {
+		return nil, fmt.Errorf("INTERSERVE_BACKENDS %q names no backends", list)
+	}
+
+	var hedge float64
+	if v := strings.TrimSpace(os.Getenv("INTERSERVE_HEDGE_PERCENTILE")); v != "" {
+		p, err := strconv.ParseFloat(v, 64)
+		if err != nil || p < 0 || p >= 100 {
+			return nil, fmt.Errorf("invalid INTERSERVE_HEDGE_PERCENTILE %q: must be between 0 and 100 (0 disables)", v)
+		}
+		hedge = p
+	}
+	return dispatch.NewFallback(backends, hedge), nil
+}
+
+// newBackend builds one named backend: shell, http, sampling or replay.
+func newBackend(s *server.MCPServer, name string, samplingShellFallback bool) (dispatch.Dispatcher, error) {
+	switch name {
+	case "", "shell":
+		return newShellDispatcher()
+	case "http":
+		return dispatch.NewOpenAIFromEnv()
+	case "sampling":
+		s.EnableSampling()
+		if !samplingShellFallback {
+			return dispatch.NewSampling(s, nil), nil
+		}
+		// dispatch.sh is optional here: without it, clients lacking sampling get an error.
+		var fallback dispatch.Dispatcher
+		if shell, err := newShellDispatcher(); err == nil {
+			fallback = shell
+		} else {
+			fmt.Fprintf(os.Stderr, "interserve-mcp: sampling backend without shell fallback: %v\n", err)
+		}
+		return dispatch.NewSampling(s, fallback), nil
+	case "replay":
+		dir := strings.TrimSpace(os.Getenv("INTERSERVE_REPLAY_DIR"))
+		if dir == "" {
+			return nil, fmt.Errorf("INTERSERVE_REPLAY_DIR is required for the replay backend")
+		}
+		return dispatch.NewReplayer(dir), nil
+	default:
+		return nil, fmt.Errorf("unknown backend %q: must be shell, http, sampling or replay", name)
+	}
+}
+
+func newShellDispatcher() (*dispatch.Shell, error) {
+	dispatchPath := os.Getenv("INTERSERVE_DISPATCH_PATH")
+	if dispatchPath == "" {
+		dispatchPath = "/root/projects/Interverse/hub/clavain/scripts/dispatch.sh"
+	}
+
+	info, err := os.Stat(dispatchPath)
+	if err != nil {
+		return nil, fmt.Errorf("dispatch path %q: %v", dispatchPath, err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("dispatch path %q is a directory, expected a file", dispatchPath)
+	}
+	shell := dispatch.NewShell(dispatchPath)
+	if v := strings.TrimSpace(os.Getenv("INTERSERVE_DISPATCH_TIMEOUT")); v != "" {
+		timeout, err := time.ParseDuration(v)
+		if err != nil || timeout < 0 {
+			return nil, fmt.Errorf("invalid INTERSERVE_DISPATCH_TIMEOUT %q: must be a duration like 90s or 5m (0 disables)", v)
+		}
+		shell.Timeout = timeout
+	}
+	return shell, nil
+}
+
+// classifyOptionsFromEnv applies INTERSERVE_ESCALATION (on/off),
+// INTERSERVE_ESCALATION_MIN_CONFIDENCE, INTERSERVE_LOCAL_FALLBACK (on/off) and
+// the INTERSERVE_SLICING_* policy over the classify defaults.
+func classifyOptionsFromEnv() (classify.Options, error) {
+	opts := classify.DefaultOptions()
+	switch v := strings.TrimSpace(os.Getenv("INTERSERVE_ESCALATION")); v {
+	case "", "on":
+	case "off":
+		opts.DisableEscalation = true
+	default:
+		return opts, fmt.Errorf("invalid INTERSERVE_ESCALATION %q: must be on or off", v)
+	}
+	if v := strings.TrimSpace(os.Getenv("INTERSERVE_ESCALATION_MIN_CONFIDENCE")); v != "" {
+		floor, err := strconv.ParseFloat(v, 64)
+		if err != nil || floor < 0 || floor > 1 {
+			return opts, fmt.Errorf("invalid INTERSERVE_ESCALATION_MIN_CONFIDENCE %q: must be between 0 and 1", v)
+		}
+		opts.EscalationMinConfidence = floor
+	}
+	switch v := strings.TrimSpace(os.Getenv("INTERSERVE_LOCAL_FALLBACK")); v {
+	case "", "on":
+	case "off":
+		opts.LocalFallback = false
+	default:
+		return opts, fmt.Errorf("invalid INTERSERVE_LOCAL_FALLBACK %q: must be on or off", v)
+	}
+	switch v := strings.TrimSpace(os.Getenv("INTERSERVE_CLASSIFY_CACHE")); v {
+	case "", "on":
+		opts.Cache = classify.NewCache(classify.DefaultCacheEntries)
+	case "off":
+	default:
+		return opts, fmt.Errorf("invalid INTERSERVE_CLASSIFY_CACHE %q: must be on or off", v)
+	}
+
+	for _, setting := range []struct {
+		name  string
+		field **float64
+	}{
+		{"INTERSERVE_SLICING_MISMATCH_FLOOR", &opts.Slicing.MismatchFloor},
+		{"INTERSERVE_SLICING_FULL_DOC_CEILING", &opts.Slicing.FullDocCeiling},
+		{"INTERSERVE_SLICING_MIN_PRIORITY_CONFIDENCE", &opts.Slicing.MinPriorityConfidence},
+	} {
+		v := strings.TrimSpace(os.Getenv(setting.name))
+		if v == "" {
+			continue
+		}
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 || f > 1 {
+			return opts, fmt.Errorf("invalid %s %q: must be between 0 and 1", setting.name, v)
+		}
+		*setting.field = &f
+	}
+	switch v := strings.TrimSpace(os.Getenv("INTERSERVE_SLICING_COUNT_CONTEXT")); v {
+	case "":
+	case "on", "off":
+		countContext := v == "on"
+		opts.Slicing.CountContext = &countContext
+	default:
+		return opts, fmt.Errorf("invalid INTERSERVE_SLICING_COUNT_CONTEXT %q: must be on or off", v)
+	}
+	return opts, nil
+}
+
+// limiterFromEnv sizes the dispatch pool from INTERSERVE_MAX_IN_FLIGHT and INTERSERVE_MAX_QUEUE.
+func limiterFromEnv() (*dispatch.Limiter, error) {
+	maxInFlight, err := positiveIntEnv("INTERSERVE_MAX_IN_FLIGHT", dispatch.DefaultMaxInFlight)
+	if err != nil {
+		return nil, err
+	}
+	maxQueue, err := positiveIntEnv("INTERSERVE_MAX_QUEUE", dispatch.DefaultMaxQueue)
+	if err != nil {
+		return nil, err
+	}
+	return dispatch.NewLimiter(maxInFlight, maxQueue), nil
+}
+
+// breakerFromEnv configures the circuit breaker from INTERSERVE_BREAKER_THRESHOLD
+// (consecutive failures before opening) and INTERSERVE_BREAKER_COOLDOWN.
+func breakerFromEnv() (*dispatch.Breaker, error) {
+	threshold, err := positiveIntEnv("INTERSERVE_BREAKER_THRESHOLD", dispatch.DefaultBreakerThreshold)
+	if err != nil {
+		return nil, err
+	}
+	cooldown := dispatch.DefaultBreakerCooldown
+	if v := strings.TrimSpace(os.Getenv("INTERSERVE_BREAKER_COOLDOWN")); v != "" {
+		cooldown, err = time.ParseDuration(v)
+		if err != nil || cooldown <= 0 {
+			return nil, fmt.Errorf("invalid INTERSERVE_BREAKER_COOLDOWN %q: must be a positive duration like 30s", v)
+		}
+	}
+	return dispatch.NewBreaker(threshold, cooldown), nil
+}
+
+func positiveIntEnv(name string, fallback int) (int, error) {
+	v := strings.TrimSpace(os.Getenv(name))
+	if v == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: must be a positive integer", name, v)
+	}
+	return n, nil
+}
@@ -0,0 +1,95 @@
+package classify
+
+import (
+	"sort"
+
+	"github.com/mistakeknot/interserve/internal/dispatch"
+	"github.com/mistakeknot/interserve/internal/extract"
+)
+
+// sectionTokens estimates the tokens an agent spends reading section.
+func sectionTokens(section extract.Section) int {
+	return dispatch.EstimateTokens("## " + section.Heading + "\n" + section.Body)
+}
+
+func sumTokens(ids []int, tokens map[int]int) int {
+	total := 0
+	for _, id := range ids {
+		total += tokens[id]
+	}
+	return total
+}
+
+// fitTokenBudget keeps the most valuable priority sections within budget and
+// demotes the rest to context. Sections are taken greedily by confidence, then
+// by lower token cost; a section that does not fit is skipped so smaller ones
+// can still use the remaining budget.
+func fitTokenBudget(slice AgentSlice, budget int, confidence map[int]float64, tokens map[int]int, sections []extract.Section) AgentSlice {
+	slice.TokenBudget = budget
+	if sumTokens(slice.PrioritySections, tokens) <= budget {
+		return slice
+	}
+
+	lines := make(map[int]int, len(sections))
+	for _, section := range sections {
+		lines[section.ID] = section.LineCount
+	}
+
+	candidates := append([]int(nil), slice.PrioritySections...)
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if confidence[a] != confidence[b] {
+			return confidence[a] > confidence[b]
+		}
+		if tokens[a] != tokens[b] {
+			return tokens[a] < tokens[b]
+		}
+		return a < b
+	})
+
+	inContext := make(map[int]bool, len(slice.ContextSections))
+	for _, id := range slice.ContextSections {
+		inContext[id] = true
+	}
+
+	kept := make([]int, 0, len(candidates))
+	remaining := budget
+	for _, id := range candidates {
+		if tokens[id] <= remaining {
+			kept = append(kept, id)
+			remaining -= tokens[id]
+			continue
+		}
+		slice.OverBudgetSections = append(slice.OverBudgetSections, id)
+		slice.TotalPriorityLines -= lines[id]
+		if !inContext[id] {
+			slice.ContextSections = append(slice.ContextSections, id)
+			slice.TotalContextLines += lines[id]
+		}
+	}
+
+	sort.Ints(kept)
+	sort.Ints(slice.ContextSections)
+	sort.Ints(slice.OverBudgetSections)
+	slice.PrioritySections = kept
+	return slice
+}
+
+// ContextTokensSaved estimates the tokens agents avoid by reading their slices
+// instead of the whole document: for each agent with at least one priority
+// section, the document's tokens less its priority and context tokens. Agents
+// the classifier matched nothing for are not dispatched, so they save nothing.
+func (r ClassifyResult) ContextTokensSaved(sections []extract.Section) int {
+	document := 0
+	for _, section := range sections {
+		document += sectionTokens(section)
+	}
+	saved := 0
+	for _, slice := range r.SlicingMap {
+		if len(slice.PrioritySections) == 0 {
+			continue
+		}
+		saved += max(document-slice.EstimatedPriorityTokens-slice.EstimatedContextTokens, 0)
+	}
+	return saved
+}
@@ -0,0 +1,106 @@
+package classify
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mistakeknot/interserve/internal/extract"
+)
+
+// budgetSections returns sections whose estimated tokens are ~tokens each.
+func budgetSections(tokens ...int) []extract.Section {
+	sections := make([]extract.Section, 0, len(tokens))
+	for i, n := range tokens {
+		sections = append(sections, extract.Section{
+			ID:        i + 1,
+			Heading:   "S",
+			Body:      strings.Repeat("x", n*4-5),
+			LineCount: 10,
+		})
+	}
+	return sections
+}
+
+func TestBuildResultFitsPriorityToTokenBudget(t *testing.T) {
+	sections := budgetSections(100, 300, 50, 400)
+	classified := map[int][]SectionAssignment{
+		1: {{Agent: "fd-safety", Relevance: "priority", Confidence: 0.6}},
+		2: {{Agent: "fd-safety", Relevance: "priority", Confidence: 0.9}},
+		3: {{Agent: "fd-safety", Relevance: "priority", Confidence: 0.5}},
+		4: {{Agent: "fd-safety", Relevance: "context", Confidence: 0.9}},
+	}
+	agents := []AgentDomain{{Name: "fd-safety", TokenBudget: 420}}
+	policy := DefaultSlicingPolicy()
+	policy.FullDocCeiling = 1
+
+	result := buildResult(classified, sections, agents, policy, 0)
+	slice := result.SlicingMap["fd-safety"]
+
+	// 2 (0.9, 300) fits; 1 (0.6, 100) fits; 3 (0.5, 50) would exceed 420.
+	if !slices.Equal(slice.PrioritySections, []int{1, 2}) {
+		t.Fatalf("priority sections = %v, want [1 2]", slice.PrioritySections)
+	}
+	if !slices.Equal(slice.OverBudgetSections, []int{3}) || !slices.Equal(slice.ContextSections, []int{3, 4}) {
+		t.Fatalf("expected section 3 demoted to context, got over=%v context=%v", slice.OverBudgetSections, slice.ContextSections)
+	}
+	if slice.TotalPriorityLines != 20 || slice.TotalContextLines != 20 {
+		t.Fatalf("line totals should follow the demotion, got %d/%d", slice.TotalPriorityLines, slice.TotalContextLines)
+	}
+	if slice.EstimatedPriorityTokens != 400 || slice.EstimatedContextTokens != 450 || slice.TokenBudget != 420 {
+		t.Fatalf("unexpected token accounting %+v", slice)
+	}
+}
+
+func TestBuildResultSkipsSectionsThatDoNotFit(t *testing.T) {
+	sections := budgetSections(500, 100, 100)
+	classified := map[int][]SectionAssignment{
+		1: {{Agent: "fd-safety", Relevance: "priority", Confidence: 0.9}},
+		2: {{Agent: "fd-safety", Relevance: "priority", Confidence: 0.5}},
+		3: {{Agent: "fd-safety", Relevance: "priority", Confidence: 0.5}},
+	}
+	policy := DefaultSlicingPolicy()
+	policy.FullDocCeiling = 1
+
+	result := buildResult(classified, sections, DefaultAgents(), policy, 250)
+	slice := result.SlicingMap["fd-safety"]
+	if !slices.Equal(slice.PrioritySections, []int{2, 3}) || !slices.Equal(slice.OverBudgetSections, []int{1}) {
+		t.Fatalf("oversized section should yield to ones that fit, got priority=%v over=%v", slice.PrioritySections, slice.OverBudgetSections)
+	}
+	if other := result.SlicingMap["fd-correctness"]; other.TokenBudget != 250 {
+		t.Fatalf("call budget should apply to every agent without its own, got %+v", other)
+	}
+}
+
+func TestBuildResultReportsTokensWithoutBudget(t *testing.T) {
+	sections := budgetSections(100, 200)
+	classified := map[int][]SectionAssignment{
+		1: {{Agent: "fd-safety", Relevance: "priority", Confidence: 0.9}},
+		2: {{Agent: "fd-safety", Relevance: "context", Confidence: 0.9}},
+	}
+
+	result := buildResult(classified, sections, DefaultAgents(), DefaultSlicingPolicy(), 0)
+	slice := result.SlicingMap["fd-safety"]
+	if slice.EstimatedPriorityTokens != 100 || slice.EstimatedContextTokens != 200 || slice.TokenBudget != 0 || slice.OverBudgetSections != nil {
+		t.Fatalf("unexpected slice %+v", slice)
+	}
+}
+
+func TestContextTokensSavedCreditsUnreadSections(t *testing.T) {
+	sections := budgetSections(100, 200)
+	classified := map[int][]SectionAssignment{
+		1: {{Agent: "fd-safety", Relevance: "priority", Confidence: 0.9}},
+		2: {{Agent: "fd-safety", Relevance: "context", Confidence: 0.9}, {Agent: "fd-quality", Relevance: "priority", Confidence: 0.9}},
+	}
+
+	result := buildResult(classified, sections, DefaultAgents(), DefaultSlicingPolicy(), 0)
+	// fd-safety reads everything and fd-quality skips section 1; the rest matched
+	// nothing and are not credited.
+	if slice, ok := result.SlicingMap["fd-performance"]; !ok || len(slice.PrioritySections) != 0 {
+		t.Fatalf("fd-performance should be in the map with no priority sections: %+v", slice)
+	}
+	want := 0 + 100
+	if got := result.ContextTokensSaved(sections); got != want {
+		t.Fatalf("ContextTokensSaved = %d, want %d", got, want)
+	}
+}
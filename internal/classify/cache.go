@@ -0,0 +1,163 @@
+package classify
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/mistakeknot/interserve/internal/extract"
+)
+
+// DefaultCacheEntries bounds the number of sections a Cache remembers.
+const DefaultCacheEntries = 1024
+
+// Cache remembers dispatched assignments per section content and agent set,
+// so re-classifying an edited document only dispatches the sections that
+// changed. It is safe for concurrent use.
+type Cache struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*cacheEntry
+	clock   uint64 // bumped on every use; the smallest lastUsed is evicted first
+	hits    int64
+	misses  int64
+}
+
+type cacheEntry struct {
+	assignments []SectionAssignment
+	lastUsed    uint64
+}
+
+// CacheStats is a snapshot of cache use, reported by diagnostics.
+type CacheStats struct {
+	Entries int   `json:"entries"`
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+}
+
+// NewCache returns a Cache holding up to maxEntries sections; values below 1
+// use DefaultCacheEntries.
+func NewCache(maxEntries int) *Cache {
+	if maxEntries < 1 {
+		maxEntries = DefaultCacheEntries
+	}
+	return &Cache{maxEntries: maxEntries, entries: make(map[string]*cacheEntry)}
+}
+
+// Stats reports the cache size and lifetime hit and miss counts.
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CacheStats{Entries: len(c.entries), Hits: c.hits, Misses: c.misses}
+}
+
+// lookup returns the cached assignments for each section it has seen with
+// this agent set, by section ID.
+func (c *Cache) lookup(sections []extract.Section, agents []AgentDomain) map[int][]SectionAssignment {
+	fingerprint := agentsFingerprint(agents)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	found := make(map[int][]SectionAssignment)
+	for _, section := range sections {
+		entry, ok := c.entries[sectionCacheKey(fingerprint, section)]
+		if !ok {
+			c.misses++
+			continue
+		}
+		c.hits++
+		c.clock++
+		entry.lastUsed = c.clock
+		found[section.ID] = cloneAssignments(entry.assignments)
+	}
+	return found
+}
+
+// store remembers classified's assignments for sections, including sections
+// that were assigned to no agent.
+func (c *Cache) store(sections []extract.Section, agents []AgentDomain, classified map[int][]SectionAssignment) {
+	fingerprint := agentsFingerprint(agents)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, section := range sections {
+		key := sectionCacheKey(fingerprint, section)
+		if _, ok := c.entries[key]; !ok && len(c.entries) >= c.maxEntries {
+			c.evictOldest()
+		}
+		c.clock++
+		c.entries[key] = &cacheEntry{assignments: cloneAssignments(classified[section.ID]), lastUsed: c.clock}
+	}
+}
+
+func (c *Cache) evictOldest() {
+	var oldestKey string
+	var oldest uint64
+	for key, entry := range c.entries {
+		if oldestKey == "" || entry.lastUsed < oldest {
+			oldestKey = key
+			oldest = entry.lastUsed
+		}
+	}
+	delete(c.entries, oldestKey)
+}
+
+// agentsFingerprint hashes what the model sees of the agent set: names,
+// descriptions and which agents are cross-cutting, independent of order.
+func agentsFingerprint(agents []AgentDomain) string {
+	lines := make([]string, 0, len(agents))
+	for _, agent := range agents {
+		lines = append(lines, fmt.Sprintf("%s\x00%s\x00%t", agent.Name, agent.Description, agent.CrossCutting))
+	}
+	sort.Strings(lines)
+
+	h := sha256.New()
+	for _, line := range lines {
+		fmt.Fprintf(h, "%s\n", line)
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))[:16]
+}
+
+// sectionCacheKey identifies a section by content, so it survives renumbering.
+func sectionCacheKey(fingerprint string, section extract.Section) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "a:%s\nh:%s\nb:%s", fingerprint, section.Heading, section.Body)
+	return fmt.Sprintf("%x", h.Sum(nil))[:16]
+}
+
+func cloneAssignments(in []SectionAssignment) []SectionAssignment {
+	out := make([]SectionAssignment, len(in))
+	copy(out, in)
+	return out
+}
+
+// uncached returns the sections without an entry in cached.
+func uncached(sections []extract.Section, cached map[int][]SectionAssignment) []extract.Section {
+	if len(cached) == 0 {
+		return sections
+	}
+	out := make([]extract.Section, 0, len(sections))
+	for _, section := range sections {
+		if _, ok := cached[section.ID]; !ok {
+			out = append(out, section)
+		}
+	}
+	return out
+}
+
+// withCached adds the cached sections to a fresh classification.
+func withCached(classified, cached map[int][]SectionAssignment) map[int][]SectionAssignment {
+	if len(cached) == 0 {
+		return classified
+	}
+	merged := make(map[int][]SectionAssignment, len(classified)+len(cached))
+	for id, assignments := range cached {
+		merged[id] = assignments
+	}
+	for id, assignments := range classified {
+		merged[id] = assignments
+	}
+	return merged
+}
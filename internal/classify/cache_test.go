@@ -0,0 +1,115 @@
+package classify
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mistakeknot/interserve/internal/dispatch"
+	"github.com/mistakeknot/interserve/internal/extract"
+)
+
+var promptSectionRE = regexp.MustCompile(`(?m)^Section (\d+)$`)
+
+// sectionEcho assigns every section named in the prompt to fd-safety and
+// records which sections each dispatch asked about.
+type sectionEcho struct {
+	mu    sync.Mutex
+	asked [][]string
+}
+
+func (e *sectionEcho) Dispatch(ctx context.Context, req dispatch.Request) (dispatch.Response, error) {
+	var ids, parts []string
+	for _, m := range promptSectionRE.FindAllStringSubmatch(req.Prompt, -1) {
+		ids = append(ids, m[1])
+		parts = append(parts, fmt.Sprintf(`{"section_id":%s,"assignments":[{"agent":"fd-safety","relevance":"priority","confidence":0.9}]}`, m[1]))
+	}
+	e.mu.Lock()
+	e.asked = append(e.asked, ids)
+	e.mu.Unlock()
+	return dispatch.Response{Output: `{"sections":[` + strings.Join(parts, ",") + `]}`}, nil
+}
+
+func cacheSections(third string) []extract.Section {
+	return []extract.Section{
+		{ID: 1, Heading: "Auth", Body: "Tokens rotate.", LineCount: 5},
+		{ID: 2, Heading: "Storage", Body: "Sessions live in a table.", LineCount: 5},
+		{ID: 3, Heading: "Rollout", Body: third, LineCount: 5},
+	}
+}
+
+func TestClassifyCacheDispatchesOnlyChangedSections(t *testing.T) {
+	echo := &sectionEcho{}
+	opts := DefaultOptions()
+	opts.Cache = NewCache(0)
+
+	first := Classify(context.Background(), echo, cacheSections("Staff first."), DefaultAgents(), opts)
+	if first.Status != "success" || first.CacheHits != 0 || first.CacheMisses != 3 {
+		t.Fatalf("first call: status %q, hits %d, misses %d", first.Status, first.CacheHits, first.CacheMisses)
+	}
+
+	again := Classify(context.Background(), echo, cacheSections("Staff first."), DefaultAgents(), opts)
+	if len(echo.asked) != 1 {
+		t.Fatalf("unchanged document should not dispatch, got %d dispatches", len(echo.asked))
+	}
+	if again.Status != "success" || again.CacheHits != 3 || again.Attempts != 0 {
+		t.Fatalf("second call: status %q, hits %d, attempts %d", again.Status, again.CacheHits, again.Attempts)
+	}
+
+	edited := Classify(context.Background(), echo, cacheSections("Staff first, then everyone."), DefaultAgents(), opts)
+	if len(echo.asked) != 2 || strings.Join(echo.asked[1], ",") != "3" {
+		t.Fatalf("expected only section 3 to be dispatched, got %v", echo.asked)
+	}
+	if edited.CacheHits != 2 || edited.CacheMisses != 1 {
+		t.Fatalf("edited call: hits %d, misses %d", edited.CacheHits, edited.CacheMisses)
+	}
+	for _, section := range edited.Sections {
+		if section.Cached != (section.SectionID != 3) {
+			t.Errorf("section %d cached = %v", section.SectionID, section.Cached)
+		}
+	}
+	if got := edited.SlicingMap["fd-safety"].PrioritySections; len(got) != 3 {
+		t.Fatalf("cached and fresh sections should both reach the slice, got %v", got)
+	}
+
+	if stats := opts.Cache.Stats(); stats.Entries != 4 || stats.Hits != 5 || stats.Misses != 4 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestClassifyCacheKeysOnAgentSet(t *testing.T) {
+	echo := &sectionEcho{}
+	opts := DefaultOptions()
+	opts.Cache = NewCache(0)
+
+	Classify(context.Background(), echo, cacheSections("x"), DefaultAgents(), opts)
+	agents := append(DefaultAgents(), AgentDomain{Name: "fd-docs", Description: "Documentation."})
+	result := Classify(context.Background(), echo, cacheSections("x"), agents, opts)
+	if len(echo.asked) != 2 || result.CacheHits != 0 {
+		t.Fatalf("a different agent set should miss the cache, got %d dispatches and %d hits", len(echo.asked), result.CacheHits)
+	}
+
+	opts.Cache = nil
+	Classify(context.Background(), echo, cacheSections("x"), DefaultAgents(), opts)
+	if len(echo.asked) != 3 {
+		t.Fatal("a nil cache should always dispatch")
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewCache(2)
+	sections := cacheSections("x")
+	agents := DefaultAgents()
+
+	cache.store(sections[:2], agents, map[int][]SectionAssignment{})
+	cache.lookup(sections[:1], agents)
+	cache.store(sections[2:], agents, map[int][]SectionAssignment{})
+
+	found := cache.lookup(sections, agents)
+	if _, ok := found[2]; ok || len(found) != 2 {
+		t.Fatalf("expected section 2 evicted, found %v", found)
+	}
+}
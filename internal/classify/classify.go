@@ -2,35 +2,73 @@ package classify
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
-	"os/exec"
+	"math"
+	"slices"
 	"sort"
 	"strings"
+	"time"
 
+	"github.com/mistakeknot/interserve/internal/dispatch"
 	"github.com/mistakeknot/interserve/internal/extract"
 )
 
 const (
 	statusSuccess          = "success"
 	statusNoClassification = "no_classification"
+
+	toolName = "classify_sections"
+
+	errDomainMismatch = "domain mismatch"
 )
 
 // ClassifyResult is the MCP-facing classification response payload.
 type ClassifyResult struct {
-	Status     string                `json:"status"`
-	Sections   []ClassifiedSection   `json:"sections"`
-	SlicingMap map[string]AgentSlice `json:"slicing_map"`
-	Error      string                `json:"error,omitempty"`
+	Status           string                `json:"status"`
+	Sections         []ClassifiedSection   `json:"sections"`
+	SlicingMap       map[string]AgentSlice `json:"slicing_map"`
+	Method           string                `json:"method,omitempty"`
+	Tier             string                `json:"tier,omitempty"`
+	Backend          string                `json:"backend,omitempty"`
+	Attempts         int                   `json:"attempts"`
+	Escalated        bool                  `json:"escalated"`
+	Samples          int                   `json:"samples,omitempty"`
+	CacheHits        int                   `json:"cache_hits,omitempty"`
+	CacheMisses      int                   `json:"cache_misses,omitempty"`
+	QueueWaitMs      int64                 `json:"queue_wait_ms"`
+	Usage            dispatch.Usage        `json:"usage"`
+	EscalationReason string                `json:"escalation_reason,omitempty"`
+	FallbackReason   string                `json:"fallback_reason,omitempty"`
+	// DispatchStatus is the status of the failed dispatch a local fallback
+	// replaced, such as backend_unavailable while the circuit is open.
+	DispatchStatus string         `json:"dispatch_status,omitempty"`
+	AgentRegistry  string         `json:"agent_registry,omitempty"`
+	Policy         *SlicingPolicy `json:"policy,omitempty"`
+	RetryAfterMs   int64          `json:"retry_after_ms,omitempty"`
+	Warnings       []string       `json:"warnings,omitempty"`
+	Decisions      []Decision     `json:"decisions,omitempty"`
+	Error          string         `json:"error,omitempty"`
+
+	// classified holds the assignments buildResult started from, before any
+	// policy applied; they are what the cache stores.
+	classified map[int][]SectionAssignment
 }
 
 // ClassifiedSection includes original section metadata and assignments.
 type ClassifiedSection struct {
-	SectionID   int                 `json:"section_id"`
-	Heading     string              `json:"heading"`
-	LineCount   int                 `json:"line_count"`
-	Assignments []SectionAssignment `json:"assignments"`
+	SectionID    int                 `json:"section_id"`
+	StableID     string              `json:"stable_id,omitempty"`
+	ContentHash  string              `json:"content_hash,omitempty"`
+	Heading      string              `json:"heading"`
+	ParentID     int                 `json:"parent_id,omitempty"`
+	LineCount    int                 `json:"line_count"`
+	StartLine    int                 `json:"start_line,omitempty"`
+	EndLine      int                 `json:"end_line,omitempty"`
+	Assignments  []SectionAssignment `json:"assignments"`
+	Disagreement bool                `json:"disagreement,omitempty"`
+	// Cached is set when the assignments were reused from an earlier call.
+	Cached bool `json:"cached,omitempty"`
 }
 
 // SectionAssignment maps a section to an agent with relevance weight.
@@ -38,6 +76,10 @@ type SectionAssignment struct {
 	Agent      string  `json:"agent"`
 	Relevance  string  `json:"relevance"`
 	Confidence float64 `json:"confidence"`
+	// Rationale says in a sentence why the section matters to the agent.
+	Rationale string `json:"rationale,omitempty"`
+	// Evidence holds lines quoted from the section that support the assignment.
+	Evidence []string `json:"evidence,omitempty"`
 }
 
 // AgentSlice summarizes which sections each agent should read first vs context.
@@ -46,6 +88,34 @@ type AgentSlice struct {
 	ContextSections    []int `json:"context_sections"`
 	TotalPriorityLines int   `json:"total_priority_lines"`
 	TotalContextLines  int   `json:"total_context_lines"`
+	// Estimated tokens are ~4 characters per token over heading and body.
+	EstimatedPriorityTokens int `json:"estimated_priority_tokens"`
+	EstimatedContextTokens  int `json:"estimated_context_tokens"`
+	TokenBudget             int `json:"token_budget,omitempty"`
+	// OverBudgetSections were priority but did not fit TokenBudget; they are
+	// included in ContextSections instead.
+	OverBudgetSections []int `json:"over_budget_sections,omitempty"`
+	// Policy is set when the agent's own slicing override applied.
+	Policy *SlicingPolicy `json:"policy,omitempty"`
+	// PriorityRanges and ContextRanges locate the sections in the source
+	// file, adjacent sections merged, for targeted reads.
+	PriorityRanges []LineRange `json:"priority_ranges,omitempty"`
+	ContextRanges  []LineRange `json:"context_ranges,omitempty"`
+}
+
+// LineRange is a span of the source file: 1-based inclusive lines and byte
+// offsets with EndByte exclusive. A Read of Lines() lines from StartLine
+// covers it.
+type LineRange struct {
+	StartLine int `json:"start_line"`
+	EndLine   int `json:"end_line"`
+	StartByte int `json:"start_byte"`
+	EndByte   int `json:"end_byte"`
+}
+
+// Lines is the number of lines in r.
+func (r LineRange) Lines() int {
+	return r.EndLine - r.StartLine + 1
 }
 
 type dispatchResponse struct {
@@ -53,12 +123,16 @@ type dispatchResponse struct {
 }
 
 type dispatchSection struct {
-	SectionID   int                 `json:"section_id"`
-	Assignments []SectionAssignment `json:"assignments"`
+	SectionID   int                  `json:"section_id"`
+	Assignments []dispatchAssignment `json:"assignments"`
 }
 
-// Classify runs Codex spark dispatch and produces section slicing metadata.
-func Classify(ctx context.Context, dispatchPath string, sections []extract.Section, agents []AgentDomain) ClassifyResult {
+// Classify dispatches a classification prompt and produces section slicing metadata.
+// Weak fast-tier results are re-run on the deep tier according to opts, and
+// failed ones fall back to the local classifier when opts.LocalFallback is set.
+// With opts.Cache, only sections whose content is new to the cache are
+// dispatched.
+func Classify(ctx context.Context, d dispatch.Dispatcher, sections []extract.Section, agents []AgentDomain, opts Options) ClassifyResult {
 	if len(agents) == 0 {
 		agents = DefaultAgents()
 	}
@@ -71,99 +145,229 @@ func Classify(ctx context.Context, dispatchPath string, sections []extract.Secti
 		}
 	}
 
-	prompt := BuildPrompt(sections, agents)
+	switch opts.Method {
+	case "", MethodDispatch:
+	case MethodLocal:
+		return localResult(sections, agents, opts)
+	default:
+		return failedResult(sections, agents, "", 0, fmt.Sprintf("invalid method %q: must be dispatch or local", opts.Method))
+	}
 
-	promptFile, err := os.CreateTemp("", "interserve-prompt-*.txt")
-	if err != nil {
-		return classifyError(err, sections, agents, "create prompt temp file")
+	result := cachedDispatch(ctx, d, sections, agents, opts)
+	result.Method = MethodDispatch
+	// A domain mismatch is the model's verdict on the document, not a failure
+	// to classify it.
+	if result.Status == statusSuccess || !opts.LocalFallback || strings.HasPrefix(result.Error, errDomainMismatch) {
+		return result
 	}
-	promptPath := promptFile.Name()
-	defer os.Remove(promptPath)
 
-	if _, err := promptFile.WriteString(prompt); err != nil {
-		_ = promptFile.Close()
-		return classifyError(err, sections, agents, "write prompt temp file")
+	// The model gave us nothing usable; a heuristic routing beats none.
+	local := localResult(sections, agents, opts)
+	if local.Status != statusSuccess {
+		return result
 	}
-	if err := promptFile.Close(); err != nil {
-		return classifyError(err, sections, agents, "close prompt temp file")
+	local.DispatchStatus = result.Status
+	local.FallbackReason = fmt.Sprintf("%s: %s", result.Status, result.Error)
+	local.Tier = result.Tier
+	local.Escalated = result.Escalated
+	local.EscalationReason = result.EscalationReason
+	local.Attempts = result.Attempts
+	local.QueueWaitMs = result.QueueWaitMs
+	local.RetryAfterMs = result.RetryAfterMs
+	local.Usage = result.Usage
+	return local
+}
+
+// localResult classifies with the local scorer.
+func localResult(sections []extract.Section, agents []AgentDomain, opts Options) ClassifyResult {
+	result := buildResult(classifyLocal(sections, agents), sections, agents, opts.slicingPolicy(), opts.TokenBudget)
+	result.Method = MethodLocal
+	return result
+}
+
+// cachedDispatch runs classifyDispatch with the sections opts.Cache already
+// knows filled in, and caches the sections of a successful result.
+func cachedDispatch(ctx context.Context, d dispatch.Dispatcher, sections []extract.Section, agents []AgentDomain, opts Options) ClassifyResult {
+	if opts.Cache == nil {
+		return classifyDispatch(ctx, d, sections, agents, nil, opts)
 	}
 
-	outputFile, err := os.CreateTemp("", "interserve-output-*.json")
-	if err != nil {
-		return classifyError(err, sections, agents, "create output temp file")
-	}
-	outputPath := outputFile.Name()
-	if err := outputFile.Close(); err != nil {
-		return classifyError(err, sections, agents, "close output temp file")
-	}
-	defer os.Remove(outputPath)
-
-	cmd := exec.CommandContext(
-		ctx,
-		"bash",
-		dispatchPath,
-		"--tier", "fast",
-		"--sandbox", "read-only",
-		"--prompt-file", promptPath,
-		"-o", outputPath,
-	)
-	combined, err := cmd.CombinedOutput()
-	if err != nil {
-		stderr := strings.TrimSpace(string(combined))
-		if stderr == "" {
-			stderr = err.Error()
-		}
-		return ClassifyResult{
-			Status:     statusNoClassification,
-			Sections:   buildEmptySections(sections),
-			SlicingMap: buildEmptySlicingMap(agents),
-			Error:      fmt.Sprintf("dispatch failed: %s", stderr),
-		}
+	cached := opts.Cache.lookup(sections, agents)
+	result := classifyDispatch(ctx, d, sections, agents, cached, opts)
+	if result.Status != statusSuccess && len(cached) == len(sections) {
+		// Sections cached from different documents need not classify well
+		// together; ask the model about this document as a whole.
+		cached = nil
+		result = classifyDispatch(ctx, d, sections, agents, nil, opts)
+	}
+	if result.Status != statusSuccess {
+		return result
 	}
 
-	rawOutput, err := os.ReadFile(outputPath)
-	if err != nil {
-		return classifyError(err, sections, agents, "read dispatch output")
+	opts.Cache.store(sections, agents, result.classified)
+	result.CacheHits = len(cached)
+	result.CacheMisses = len(sections) - len(cached)
+	for i, section := range result.Sections {
+		_, result.Sections[i].Cached = cached[section.SectionID]
 	}
+	return result
+}
 
-	payload := strings.TrimSpace(string(rawOutput))
-	if payload == "" {
-		payload = strings.TrimSpace(string(combined))
+// classifyDispatch classifies via the dispatcher on the fast tier, escalating
+// weak results to the deep tier according to opts. Sections in cached are
+// not dispatched; their assignments are used as they are.
+func classifyDispatch(ctx context.Context, d dispatch.Dispatcher, sections []extract.Section, agents []AgentDomain, cached map[int][]SectionAssignment, opts Options) ClassifyResult {
+	pending := uncached(sections, cached)
+	if len(pending) == 0 {
+		return buildResult(cached, sections, agents, opts.slicingPolicy(), opts.TokenBudget)
 	}
-	payload = stripCodeFences(payload)
-	if payload == "" {
-		return ClassifyResult{
-			Status:     statusNoClassification,
-			Sections:   buildEmptySections(sections),
-			SlicingMap: buildEmptySlicingMap(agents),
-			Error:      "dispatch returned empty classification output",
-		}
+
+	prompt := BuildPrompt(pending, agents)
+	result := classifyTier(ctx, d, prompt, dispatch.TierFast, sections, cached, agents, opts)
+
+	reason := escalationReason(result, opts)
+	if reason == "" {
+		return result
 	}
 
-	var decoded dispatchResponse
-	if err := json.Unmarshal([]byte(payload), &decoded); err != nil {
-		return ClassifyResult{
-			Status:     statusNoClassification,
-			Sections:   buildEmptySections(sections),
-			SlicingMap: buildEmptySlicingMap(agents),
-			Error:      fmt.Sprintf("invalid classification JSON: %v", err),
-		}
+	deep := classifyTier(ctx, d, prompt, dispatch.TierDeep, sections, cached, agents, opts)
+	deep.Attempts += result.Attempts
+	deep.QueueWaitMs += result.QueueWaitMs
+	deep.Usage = deep.Usage.Add(result.Usage)
+	deep.Escalated = true
+	deep.EscalationReason = reason
+	if deep.Status != statusSuccess && result.Status == statusSuccess {
+		// A low-confidence answer beats no answer; keep the fast result.
+		result.Attempts = deep.Attempts
+		result.QueueWaitMs = deep.QueueWaitMs
+		result.Usage = deep.Usage
+		result.Escalated = true
+		result.EscalationReason = fmt.Sprintf("%s; deep tier failed: %s", reason, deep.Error)
+		return result
 	}
+	return deep
+}
+
+// classifyTier classifies the sections not in cached on tier, voting across
+// opts.Samples dispatches when more than one sample is requested.
+func classifyTier(ctx context.Context, d dispatch.Dispatcher, prompt, tier string, sections []extract.Section, cached map[int][]SectionAssignment, agents []AgentDomain, opts Options) ClassifyResult {
+	if opts.Samples > 1 {
+		return classifyEnsemble(ctx, d, prompt, tier, sections, cached, agents, opts)
+	}
+
+	s := runSample(ctx, d, prompt, tier, uncached(sections, cached), agents)
+	if s.err != "" {
+		return s.failedResult(sections, agents, tier)
+	}
+	result := buildResult(withCached(s.classified, cached), sections, agents, opts.slicingPolicy(), opts.TokenBudget)
+	result.Warnings = s.warnings
+	result.Decisions = append(s.decisions, result.Decisions...)
+	result.Tier = tier
+	result.Backend = s.backend
+	result.Attempts = s.attempts
+	result.QueueWaitMs = s.queueWait.Milliseconds()
+	result.Usage = s.usage
+	return result
+}
 
-	classified := make(map[int][]SectionAssignment, len(decoded.Sections))
-	for _, section := range decoded.Sections {
-		classified[section.SectionID] = append(classified[section.SectionID], section.Assignments...)
+// sample is the outcome of a single classification dispatch.
+type sample struct {
+	classified map[int][]SectionAssignment
+	attempts   int
+	queueWait  time.Duration
+	usage      dispatch.Usage
+	backend    string
+	warnings   []string
+	decisions  []Decision
+	status     string
+	retryAfter time.Duration
+	err        string
+}
+
+func (s sample) failedResult(sections []extract.Section, agents []AgentDomain, tier string) ClassifyResult {
+	result := failedResult(sections, agents, tier, s.attempts, s.err)
+	result.Status = s.status
+	result.QueueWaitMs = s.queueWait.Milliseconds()
+	result.Usage = s.usage
+	result.RetryAfterMs = s.retryAfter.Milliseconds()
+	return result
+}
+
+// runSample runs one dispatch (plus at most one JSON repair retry) on tier and
+// validates the decoded response against the response schema.
+func runSample(ctx context.Context, d dispatch.Dispatcher, prompt, tier string, sections []extract.Section, agents []AgentDomain) sample {
+	s := sample{attempts: 1, status: statusNoClassification}
+	schema := ResponseSchema(sections, agents)
+	resp, err := d.Dispatch(ctx, dispatch.Request{Prompt: prompt, Tier: tier, Tool: toolName, Schema: schema})
+	s.queueWait += resp.QueueWait
+	s.usage = s.usage.Add(resp.Usage)
+	if err != nil {
+		s.status = dispatch.ErrorStatus(err, statusNoClassification)
+		s.retryAfter = dispatch.RetryAfter(err)
+		s.err = fmt.Sprintf("dispatch failed: %v", err)
+		return s
+	}
+
+	decoded, parseErr := parseDispatchResponse(resp.Output)
+	if parseErr != nil {
+		// One corrective retry: show the model its own output and the parse error.
+		s.attempts++
+		repair := BuildRepairPrompt(prompt, resp.Output, parseErr)
+		resp, err = d.Dispatch(ctx, dispatch.Request{Prompt: repair, Tier: tier, Tool: toolName, Schema: schema})
+		s.queueWait += resp.QueueWait
+		s.usage = s.usage.Add(resp.Usage)
+		if err != nil {
+			s.status = dispatch.ErrorStatus(err, statusNoClassification)
+			s.retryAfter = dispatch.RetryAfter(err)
+			s.err = fmt.Sprintf("dispatch failed on repair attempt: %v", err)
+			return s
+		}
+		decoded, parseErr = parseDispatchResponse(resp.Output)
+	}
+	s.backend = resp.Backend
+	if errors.Is(parseErr, errEmptyOutput) {
+		s.err = "dispatch returned empty classification output"
+		return s
+	}
+	if parseErr != nil {
+		s.err = fmt.Sprintf("invalid classification JSON: %v", parseErr)
+		return s
 	}
 
-	return buildResult(classified, sections, agents)
+	s.classified, s.warnings, s.decisions = validateResponse(decoded, sections, agents)
+	return s
 }
 
-func classifyError(err error, sections []extract.Section, agents []AgentDomain, context string) ClassifyResult {
+// mismatchError reports the mismatch floors that applied: the shared one when
+// every agent's is the same, otherwise each agent's own.
+func mismatchError(agents []AgentDomain, floors map[string]float64, globalFloor float64) string {
+	shared, uniform := globalFloor, true
+	var each []string
+	for _, agent := range agents {
+		floor, ok := floors[agent.Name]
+		if !ok {
+			continue
+		}
+		if len(each) == 0 {
+			shared = floor
+		}
+		uniform = uniform && floor == shared
+		each = append(each, fmt.Sprintf("%s >%g%%", agent.Name, percent(floor)))
+	}
+	if uniform {
+		return fmt.Sprintf("%s: no agent has >%g%% priority lines", errDomainMismatch, percent(shared))
+	}
+	return fmt.Sprintf("%s: no agent has more priority lines than its mismatch floor (%s)", errDomainMismatch, strings.Join(each, ", "))
+}
+
+func failedResult(sections []extract.Section, agents []AgentDomain, tier string, attempts int, msg string) ClassifyResult {
 	return ClassifyResult{
 		Status:     statusNoClassification,
 		Sections:   buildEmptySections(sections),
 		SlicingMap: buildEmptySlicingMap(agents),
-		Error:      fmt.Sprintf("%s: %v", context, err),
+		Tier:       tier,
+		Attempts:   attempts,
+		Error:      msg,
 	}
 }
 
@@ -172,8 +376,13 @@ func buildEmptySections(sections []extract.Section) []ClassifiedSection {
 	for _, section := range sections {
 		out = append(out, ClassifiedSection{
 			SectionID:   section.ID,
+			StableID:    section.StableID,
+			ContentHash: section.ContentHash,
 			Heading:     section.Heading,
+			ParentID:    section.Parent,
 			LineCount:   section.LineCount,
+			StartLine:   section.StartLine,
+			EndLine:     section.EndLine,
 			Assignments: []SectionAssignment{},
 		})
 	}
@@ -186,6 +395,10 @@ func buildEmptySlicingMap(agents []AgentDomain) map[string]AgentSlice {
 	}
 	out := make(map[string]AgentSlice, len(agents))
 	for _, agent := range agents {
+		if agent.CrossCutting {
+			// Cross-cutting agents only get a slice when something is assigned to them.
+			continue
+		}
 		out[agent.Name] = AgentSlice{
 			PrioritySections: []int{},
 			ContextSections:  []int{},
@@ -194,36 +407,85 @@ func buildEmptySlicingMap(agents []AgentDomain) map[string]AgentSlice {
 	return out
 }
 
-func buildResult(classified map[int][]SectionAssignment, sections []extract.Section, agents []AgentDomain) ClassifyResult {
+// buildResult turns assignments into per-agent slices under policy, which
+// each agent's own Slicing override refines, and fits each agent's priority
+// sections into its token budget (agent.TokenBudget, else defaultBudget; zero
+// means unlimited). Every rule that changes the outcome is recorded in
+// Decisions.
+func buildResult(classified map[int][]SectionAssignment, sections []extract.Section, agents []AgentDomain, policy SlicingPolicy, defaultBudget int) ClassifyResult {
 	if len(agents) == 0 {
 		agents = DefaultAgents()
 	}
 
-	allowed := make(map[string]bool, len(agents)+len(CrossCuttingAgents))
+	allowed := allowedAgents(agents)
+	minConfidence := make(map[string]float64, len(agents))
+	policies := make(map[string]SlicingPolicy, len(agents))
 	for _, agent := range agents {
-		allowed[agent.Name] = true
-	}
-	for agent := range CrossCuttingAgents {
-		allowed[agent] = true
+		minConfidence[agent.Name] = agent.MinConfidence
+		policies[agent.Name] = policy.Apply(agent.Slicing)
 	}
 
 	result := ClassifyResult{
 		Status:     statusNoClassification,
 		Sections:   make([]ClassifiedSection, 0, len(sections)),
 		SlicingMap: buildEmptySlicingMap(agents),
+		Policy:     &policy,
+		classified: classified,
 	}
 
 	prioritySeen := make(map[string]map[int]bool)
 	contextSeen := make(map[string]map[int]bool)
+	// priorityConfidence[agent][section] is the best priority confidence, for budgeting.
+	priorityConfidence := make(map[string]map[int]float64)
+	tokens := make(map[int]int, len(sections))
+	finish := func() ClassifyResult {
+		for agent, slice := range result.SlicingMap {
+			slice.EstimatedPriorityTokens = sumTokens(slice.PrioritySections, tokens)
+			slice.EstimatedContextTokens = sumTokens(slice.ContextSections, tokens)
+			slice.PriorityRanges = sectionRanges(slice.PrioritySections, sections)
+			slice.ContextRanges = sectionRanges(slice.ContextSections, sections)
+			result.SlicingMap[agent] = slice
+		}
+		return result
+	}
 
 	totalLines := 0
 	for _, section := range sections {
 		totalLines += section.LineCount
+		tokens[section.ID] = sectionTokens(section)
 		normalized := normalizeAssignments(classified[section.ID], allowed)
+		normalized = slices.DeleteFunc(normalized, func(a SectionAssignment) bool {
+			if a.Confidence >= minConfidence[a.Agent] {
+				return false
+			}
+			result.Decisions = append(result.Decisions, Decision{
+				Rule:      ruleMinConfidence,
+				SectionID: section.ID,
+				Agent:     a.Agent,
+				Detail:    fmt.Sprintf("confidence %g is below min_confidence %g; assignment dropped", a.Confidence, minConfidence[a.Agent]),
+			})
+			return true
+		})
+		for i, a := range normalized {
+			if floor := policies[a.Agent].MinPriorityConfidence; a.Relevance == "priority" && a.Confidence < floor {
+				normalized[i].Relevance = "context"
+				result.Decisions = append(result.Decisions, Decision{
+					Rule:      ruleMinPriorityConfidence,
+					SectionID: section.ID,
+					Agent:     a.Agent,
+					Detail:    fmt.Sprintf("confidence %g is below min_priority_confidence %g; demoted to context", a.Confidence, floor),
+				})
+			}
+		}
 		result.Sections = append(result.Sections, ClassifiedSection{
 			SectionID:   section.ID,
+			StableID:    section.StableID,
+			ContentHash: section.ContentHash,
 			Heading:     section.Heading,
+			ParentID:    section.Parent,
 			LineCount:   section.LineCount,
+			StartLine:   section.StartLine,
+			EndLine:     section.EndLine,
 			Assignments: normalized,
 		})
 
@@ -238,6 +500,12 @@ func buildResult(classified map[int][]SectionAssignment, sections []extract.Sect
 					slice.TotalPriorityLines += section.LineCount
 					prioritySeen[assignment.Agent][section.ID] = true
 				}
+				if priorityConfidence[assignment.Agent] == nil {
+					priorityConfidence[assignment.Agent] = map[int]float64{}
+				}
+				if assignment.Confidence > priorityConfidence[assignment.Agent][section.ID] {
+					priorityConfidence[assignment.Agent][section.ID] = assignment.Confidence
+				}
 			} else {
 				if contextSeen[assignment.Agent] == nil {
 					contextSeen[assignment.Agent] = map[int]bool{}
@@ -259,32 +527,57 @@ func buildResult(classified map[int][]SectionAssignment, sections []extract.Sect
 	}
 
 	if totalLines <= 0 {
-		return result
+		return finish()
 	}
 
-	// Domain mismatch guard: if no agent has >10% priority lines, classification likely failed.
+	for _, agent := range agents {
+		if agent.Slicing == nil {
+			continue
+		}
+		agentPolicy := policies[agent.Name]
+		slice := result.SlicingMap[agent.Name]
+		slice.Policy = &agentPolicy
+		result.SlicingMap[agent.Name] = slice
+	}
+
+	// Domain mismatch guard: if no agent clears its mismatch floor, classification likely failed.
 	anyAboveThreshold := false
+	floors := make(map[string]float64, len(agents))
 	for _, agent := range agents {
-		if result.SlicingMap[agent.Name].TotalPriorityLines*100/totalLines > 10 {
+		if agent.CrossCutting {
+			continue
+		}
+		agentPolicy := policies[agent.Name]
+		if agentPolicy.measuredFraction(result.SlicingMap[agent.Name], totalLines) > agentPolicy.MismatchFloor {
 			anyAboveThreshold = true
 			break
 		}
+		floors[agent.Name] = agentPolicy.MismatchFloor
 	}
 	if !anyAboveThreshold {
-		result.Error = "domain mismatch: no agent has >10% priority lines"
-		return result
+		result.Error = mismatchError(agents, floors, policy.MismatchFloor)
+		result.Decisions = append(result.Decisions, Decision{Rule: ruleMismatchGuard, Detail: result.Error})
+		return finish()
 	}
 
-	// Classification succeeded — apply per-agent 80% threshold.
+	// Classification succeeded — send the full document to agents at their ceiling.
 	result.Status = statusSuccess
 	allSectionIDs := make([]int, 0, len(sections))
 	for _, s := range sections {
 		allSectionIDs = append(allSectionIDs, s.ID)
 	}
 	for _, agent := range agents {
+		if agent.CrossCutting {
+			continue
+		}
 		slice := result.SlicingMap[agent.Name]
-		// Integer arithmetic: priority_lines*100/total_lines >= 80 → send full doc.
-		if slice.TotalPriorityLines*100/totalLines >= 80 {
+		agentPolicy := policies[agent.Name]
+		if fraction := agentPolicy.measuredFraction(slice, totalLines); fraction >= agentPolicy.FullDocCeiling {
+			result.Decisions = append(result.Decisions, Decision{
+				Rule:   ruleFullDocument,
+				Agent:  agent.Name,
+				Detail: fmt.Sprintf("%g%% of lines measured reaches full_doc_ceiling %g%%; whole document sent", percent(fraction), percent(agentPolicy.FullDocCeiling)),
+			})
 			slice.PrioritySections = allSectionIDs
 			slice.TotalPriorityLines = totalLines
 			slice.ContextSections = nil
@@ -293,7 +586,36 @@ func buildResult(classified map[int][]SectionAssignment, sections []extract.Sect
 		}
 	}
 
-	return result
+	for _, agent := range agents {
+		budget := agent.TokenBudget
+		if budget <= 0 {
+			budget = defaultBudget
+		}
+		slice, ok := result.SlicingMap[agent.Name]
+		if budget <= 0 || !ok {
+			continue
+		}
+		slice = fitTokenBudget(slice, budget, priorityConfidence[agent.Name], tokens, sections)
+		for _, id := range slice.OverBudgetSections {
+			result.Decisions = append(result.Decisions, Decision{
+				Rule:      ruleTokenBudget,
+				SectionID: id,
+				Agent:     agent.Name,
+				Detail:    fmt.Sprintf("%d estimated tokens did not fit token_budget %d; demoted to context", tokens[id], budget),
+			})
+		}
+		result.SlicingMap[agent.Name] = slice
+	}
+
+	return finish()
+}
+
+func allowedAgents(agents []AgentDomain) map[string]bool {
+	allowed := make(map[string]bool, len(agents))
+	for _, agent := range agents {
+		allowed[agent.Name] = true
+	}
+	return allowed
 }
 
 func normalizeAssignments(in []SectionAssignment, allowed map[string]bool) []SectionAssignment {
@@ -318,23 +640,35 @@ func normalizeAssignments(in []SectionAssignment, allowed map[string]bool) []Sec
 	return out
 }
 
-func stripCodeFences(raw string) string {
-	trimmed := strings.TrimSpace(raw)
-	if !strings.HasPrefix(trimmed, "```") {
-		return trimmed
+// sectionRanges returns the source ranges of the sections with ids, in file
+// order, merging sections that touch. Sections without a source position are
+// skipped.
+func sectionRanges(ids []int, sections []extract.Section) []LineRange {
+	wanted := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
 	}
-
-	lines := strings.Split(trimmed, "\n")
-	if len(lines) == 0 {
-		return ""
+	var ranges []LineRange
+	for _, section := range sections {
+		if !wanted[section.ID] || section.StartLine == 0 {
+			continue
+		}
+		if n := len(ranges); n > 0 && ranges[n-1].EndLine+1 == section.StartLine {
+			ranges[n-1].EndLine = section.EndLine
+			ranges[n-1].EndByte = section.EndByte
+			continue
+		}
+		ranges = append(ranges, LineRange{
+			StartLine: section.StartLine,
+			EndLine:   section.EndLine,
+			StartByte: section.StartByte,
+			EndByte:   section.EndByte,
+		})
 	}
+	return ranges
+}
 
-	lines = lines[1:]
-	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
-		lines = lines[:len(lines)-1]
-	}
-	if len(lines) > 0 && strings.HasPrefix(strings.TrimSpace(lines[len(lines)-1]), "```") {
-		lines = lines[:len(lines)-1]
-	}
-	return strings.TrimSpace(strings.Join(lines, "\n"))
+// percent renders a fraction as a percentage without float noise (0.1 → 10).
+func percent(fraction float64) float64 {
+	return math.Round(fraction*10000) / 100
 }
@@ -1,10 +1,14 @@
 package classify
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/mistakeknot/interserve/internal/dispatch"
 	"github.com/mistakeknot/interserve/internal/extract"
 )
 
@@ -56,7 +60,7 @@ func TestBuildResultAppliesEightyPercentThreshold(t *testing.T) {
 			2: {{Agent: "fd-safety", Relevance: "context", Confidence: 0.7}},
 		}
 
-		result := buildResult(classified, sections, agents)
+		result := buildResult(classified, sections, agents, DefaultSlicingPolicy(), 0)
 		if result.Status != "success" {
 			t.Fatalf("expected success, got %q: %s", result.Status, result.Error)
 		}
@@ -80,7 +84,7 @@ func TestBuildResultAppliesEightyPercentThreshold(t *testing.T) {
 			2: {{Agent: "fd-safety", Relevance: "context", Confidence: 0.7}},
 		}
 
-		result := buildResult(classified, sections, agents)
+		result := buildResult(classified, sections, agents, DefaultSlicingPolicy(), 0)
 		if result.Status != "success" {
 			t.Fatalf("expected success (79%% > 10%% mismatch guard), got %q: %s", result.Status, result.Error)
 		}
@@ -103,7 +107,7 @@ func TestBuildResultDomainMismatchGuard(t *testing.T) {
 		1: {{Agent: "fd-safety", Relevance: "priority", Confidence: 0.6}}, // 5/50 = 10%
 	}
 
-	result := buildResult(classified, sections, agents)
+	result := buildResult(classified, sections, agents, DefaultSlicingPolicy(), 0)
 	if result.Status != "no_classification" {
 		t.Fatalf("expected domain mismatch guard to keep no_classification, got %q", result.Status)
 	}
@@ -116,3 +120,188 @@ func makeBody(lines int) string {
 	}
 	return strings.Join(out, "\n")
 }
+
+func TestClassifyUsesDispatcherOutput(t *testing.T) {
+	sections := []extract.Section{
+		{ID: 1, Heading: "Auth", Body: "Token handling", LineCount: 40},
+		{ID: 2, Heading: "Misc", Body: "Notes", LineCount: 60},
+	}
+	var gotReq dispatch.Request
+	d := dispatch.Func(func(ctx context.Context, req dispatch.Request) (dispatch.Response, error) {
+		gotReq = req
+		return dispatch.Response{Output: "```json\n" + `{"sections":[{"section_id":1,"assignments":[{"agent":"fd-safety","relevance":"priority","confidence":0.9}]}]}` + "\n```"}, nil
+	})
+
+	result := Classify(context.Background(), d, sections, DefaultAgents(), Options{})
+	if result.Status != "success" {
+		t.Fatalf("expected success, got %q: %s", result.Status, result.Error)
+	}
+	if gotReq.Tier != dispatch.TierFast || !strings.Contains(gotReq.Prompt, "Heading: Auth") {
+		t.Fatalf("unexpected dispatch request: %+v", gotReq)
+	}
+	if got := result.SlicingMap["fd-safety"].PrioritySections; len(got) != 1 || got[0] != 1 {
+		t.Fatalf("unexpected fd-safety priority sections %v", got)
+	}
+}
+
+func TestClassifyReportsDispatchError(t *testing.T) {
+	sections := []extract.Section{{ID: 1, Heading: "A", LineCount: 1}}
+	d := dispatch.Func(func(ctx context.Context, req dispatch.Request) (dispatch.Response, error) {
+		return dispatch.Response{}, errors.New("backend down")
+	})
+
+	result := Classify(context.Background(), d, sections, DefaultAgents(), Options{})
+	if result.Status != "no_classification" {
+		t.Fatalf("expected no_classification, got %q", result.Status)
+	}
+	if result.Error != "dispatch failed: backend down" {
+		t.Fatalf("unexpected error %q", result.Error)
+	}
+}
+
+func TestBuildResultAppliesPerAgentThresholds(t *testing.T) {
+	sections := []extract.Section{
+		{ID: 1, Heading: "A", LineCount: 60},
+		{ID: 2, Heading: "B", LineCount: 40},
+	}
+	agents := []AgentDomain{
+		{Name: "fd-safety", Slicing: &PolicyOverride{FullDocCeiling: ptr(0.6)}},
+		{Name: "fd-correctness", MinConfidence: 0.5},
+		{Name: "fd-architecture", CrossCutting: true},
+	}
+	classified := map[int][]SectionAssignment{
+		1: {
+			{Agent: "fd-safety", Relevance: "priority", Confidence: 0.9},
+			{Agent: "fd-correctness", Relevance: "priority", Confidence: 0.4},
+			{Agent: "fd-architecture", Relevance: "context", Confidence: 0.8},
+		},
+		2: {{Agent: "fd-correctness", Relevance: "priority", Confidence: 0.8}},
+	}
+
+	result := buildResult(classified, sections, agents, DefaultSlicingPolicy(), 0)
+	if result.Status != "success" {
+		t.Fatalf("expected success, got %q: %s", result.Status, result.Error)
+	}
+	if got := result.SlicingMap["fd-safety"].PrioritySections; len(got) != 2 {
+		t.Fatalf("60%% priority meets a 0.6 threshold; expected full document, got %v", got)
+	}
+	if got := result.SlicingMap["fd-correctness"].PrioritySections; len(got) != 1 || got[0] != 2 {
+		t.Fatalf("assignment below min_confidence should be dropped, got %v", got)
+	}
+	if got := result.SlicingMap["fd-architecture"].ContextSections; len(got) != 1 || got[0] != 1 {
+		t.Fatalf("cross-cutting agent should keep its assignment, got %v", got)
+	}
+}
+
+func TestBuildPromptListsCrossCuttingAgentsSeparately(t *testing.T) {
+	prompt := BuildPrompt([]extract.Section{{ID: 1, Heading: "A"}}, []AgentDomain{
+		{Name: "fd-safety", Description: "Safety."},
+		{Name: "fd-quality", CrossCutting: true},
+		{Name: "fd-docs", Description: "Documentation.", CrossCutting: true},
+	})
+	if !strings.Contains(prompt, "Agent domains:\n- fd-safety: Safety.\n\nCross-cutting agents (optional):\n- fd-docs: Documentation.\n- fd-quality\n") {
+		t.Fatalf("unexpected agent listing:\n%s", prompt)
+	}
+}
+
+func TestClassifyReportsOverloaded(t *testing.T) {
+	sections := []extract.Section{{ID: 1, Heading: "A", LineCount: 1}}
+	d := dispatch.Func(func(ctx context.Context, req dispatch.Request) (dispatch.Response, error) {
+		if req.Tool != "classify_sections" {
+			t.Errorf("expected classify_sections tool, got %q", req.Tool)
+		}
+		return dispatch.Response{QueueWait: 5 * time.Millisecond}, fmt.Errorf("%w: 4 in flight, 32 queued", dispatch.ErrOverloaded)
+	})
+
+	result := Classify(context.Background(), d, sections, DefaultAgents(), Options{})
+	if result.Status != "overloaded" {
+		t.Fatalf("expected overloaded status, got %q: %s", result.Status, result.Error)
+	}
+	if result.QueueWaitMs != 5 {
+		t.Fatalf("expected queue wait to be reported, got %d", result.QueueWaitMs)
+	}
+}
+
+func TestClassifyReportsBackendUnavailable(t *testing.T) {
+	sections := []extract.Section{{ID: 1, Heading: "A", LineCount: 1}}
+	d := dispatch.Func(func(ctx context.Context, req dispatch.Request) (dispatch.Response, error) {
+		return dispatch.Response{}, &dispatch.BreakerOpenError{RetryAfter: 12 * time.Second}
+	})
+
+	result := Classify(context.Background(), d, sections, DefaultAgents(), DefaultOptions())
+	if result.Status != "backend_unavailable" {
+		t.Fatalf("expected backend_unavailable status, got %q: %s", result.Status, result.Error)
+	}
+	if result.RetryAfterMs != 12000 {
+		t.Fatalf("expected retry hint, got %d", result.RetryAfterMs)
+	}
+	if result.Escalated {
+		t.Fatal("an unavailable backend should not be escalated")
+	}
+}
+
+func TestClassifyReportsTimeout(t *testing.T) {
+	sections := []extract.Section{{ID: 1, Heading: "A", LineCount: 1}}
+	d := dispatch.Func(func(ctx context.Context, req dispatch.Request) (dispatch.Response, error) {
+		return dispatch.Response{}, fmt.Errorf("%w after 5m0s", dispatch.ErrTimeout)
+	})
+
+	result := Classify(context.Background(), d, sections, DefaultAgents(), Options{})
+	if result.Status != "timeout" {
+		t.Fatalf("expected timeout status, got %q: %s", result.Status, result.Error)
+	}
+}
+
+func TestClassifySubsections(t *testing.T) {
+	doc := "## Auth\nOverview.\n### Tokens\nRotate on privilege change.\n### Latency\np99 under 150ms.\n## Rollout\nStaff first."
+	sections := extract.ExtractLevels(doc, extract.Levels{Min: 2, Max: 3})
+
+	var prompt string
+	d := dispatch.Func(func(ctx context.Context, req dispatch.Request) (dispatch.Response, error) {
+		prompt = req.Prompt
+		return dispatch.Response{Output: `{"sections":[
+			{"section_id":2,"assignments":[{"agent":"fd-safety","relevance":"priority","confidence":0.9}]},
+			{"section_id":3,"assignments":[{"agent":"fd-performance","relevance":"priority","confidence":0.9}]}
+		]}`}, nil
+	})
+
+	result := Classify(context.Background(), d, sections, DefaultAgents(), DefaultOptions())
+	if result.Status != "success" {
+		t.Fatalf("expected success, got %q: %s", result.Status, result.Error)
+	}
+	if !strings.Contains(prompt, "Section 3\nHeading: Latency\nSubsection of: Section 1\n") {
+		t.Fatalf("prompt should place subsections under their parent:\n%s", prompt)
+	}
+	if result.Sections[2].ParentID != 1 || result.Sections[0].ParentID != 0 {
+		t.Fatalf("unexpected parent ids %+v", result.Sections)
+	}
+	if got := result.SlicingMap["fd-performance"].PrioritySections; len(got) != 1 || got[0] != 3 {
+		t.Fatalf("fd-performance should get only the Latency subsection, got %v", got)
+	}
+}
+
+func TestBuildResultReportsSourceRanges(t *testing.T) {
+	doc := "---\nx: 1\n---\n## A\na\n## B\nb\nb\n## C\nc\n## D\nd\n"
+	sections := extract.ExtractSections(doc)
+	classified := map[int][]SectionAssignment{
+		1: {{Agent: "fd-safety", Relevance: "priority", Confidence: 0.9}},
+		2: {{Agent: "fd-safety", Relevance: "priority", Confidence: 0.9}},
+		4: {{Agent: "fd-safety", Relevance: "context", Confidence: 0.9}},
+	}
+
+	result := buildResult(classified, sections, DefaultAgents(), DefaultSlicingPolicy(), 0)
+	slice := result.SlicingMap["fd-safety"]
+	want := []LineRange{{StartLine: 4, EndLine: 8, StartByte: 13, EndByte: 28}}
+	if fmt.Sprint(slice.PriorityRanges) != fmt.Sprint(want) {
+		t.Fatalf("priority ranges = %+v, want %+v", slice.PriorityRanges, want)
+	}
+	if got := doc[slice.PriorityRanges[0].StartByte:slice.PriorityRanges[0].EndByte]; got != "## A\na\n## B\nb\nb" {
+		t.Fatalf("priority bytes = %q", got)
+	}
+	if len(slice.ContextRanges) != 1 || slice.ContextRanges[0].StartLine != 11 || slice.ContextRanges[0].Lines() != 2 {
+		t.Fatalf("unexpected context ranges %+v", slice.ContextRanges)
+	}
+	if result.Sections[2].StartLine != 9 || result.Sections[2].EndLine != 10 {
+		t.Fatalf("section C should span lines 9-10, got %+v", result.Sections[2])
+	}
+}
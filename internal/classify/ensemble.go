@@ -0,0 +1,166 @@
+package classify
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mistakeknot/interserve/internal/dispatch"
+	"github.com/mistakeknot/interserve/internal/extract"
+)
+
+// MaxSamples caps ensemble size so one call cannot fan out unboundedly.
+const MaxSamples = 7
+
+// classifyEnsemble dispatches n samples concurrently and merges them by
+// majority vote. Confidence becomes the fraction of samples that agreed, so the
+// model's self-reported confidence is ignored.
+func classifyEnsemble(ctx context.Context, d dispatch.Dispatcher, prompt, tier string, sections []extract.Section, cached map[int][]SectionAssignment, agents []AgentDomain, opts Options) ClassifyResult {
+	n := opts.Samples
+	if n > MaxSamples {
+		n = MaxSamples
+	}
+	pending := uncached(sections, cached)
+
+	samples := make([]sample, n)
+	var wg sync.WaitGroup
+	for i := range samples {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			samples[i] = runSample(ctx, d, prompt, tier, pending, agents)
+		}(i)
+	}
+	wg.Wait()
+
+	// Samples run in parallel, so the caller waited for the longest queue.
+	var total sample
+	var firstFailure *sample
+	succeeded := make([]map[int][]SectionAssignment, 0, n)
+	var backends, warnings []string
+	var decisions []Decision
+	for i, s := range samples {
+		total.attempts += s.attempts
+		total.queueWait = max(total.queueWait, s.queueWait)
+		total.usage = total.usage.Add(s.usage)
+		if s.err != "" {
+			if firstFailure == nil {
+				firstFailure = &samples[i]
+			}
+			continue
+		}
+		succeeded = append(succeeded, s.classified)
+		for _, w := range s.warnings {
+			warnings = append(warnings, fmt.Sprintf("sample %d: %s", i+1, w))
+		}
+		for _, decision := range s.decisions {
+			decision.Detail = fmt.Sprintf("sample %d: %s", i+1, decision.Detail)
+			decisions = append(decisions, decision)
+		}
+		if !slices.Contains(backends, s.backend) {
+			backends = append(backends, s.backend)
+		}
+	}
+	if len(succeeded) == 0 {
+		failed := *firstFailure
+		failed.attempts = total.attempts
+		failed.queueWait = total.queueWait
+		failed.usage = total.usage
+		return failed.failedResult(sections, agents, tier)
+	}
+
+	merged, disagreements := mergeVotes(succeeded, allowedAgents(agents))
+	result := buildResult(withCached(merged, cached), sections, agents, opts.slicingPolicy(), opts.TokenBudget)
+	for i := range result.Sections {
+		result.Sections[i].Disagreement = disagreements[result.Sections[i].SectionID]
+	}
+	result.Tier = tier
+	result.Backend = strings.Join(backends, ",")
+	result.Warnings = warnings
+	result.Decisions = append(decisions, result.Decisions...)
+	result.Attempts = total.attempts
+	result.QueueWaitMs = total.queueWait.Milliseconds()
+	result.Usage = total.usage
+	result.Samples = len(succeeded)
+	return result
+}
+
+type agentVotes struct {
+	priority int
+	context  int
+	// first holds the first assignment seen per relevance, whose rationale and
+	// evidence the merged assignment reuses.
+	first map[string]SectionAssignment
+}
+
+// mergeVotes keeps an agent on a section when a strict majority of samples
+// assigned it. Relevance is the majority relevance among those votes (ties go to
+// context) and the rationale and evidence come from the first sample voting
+// for it. A section is flagged when any agent or relevance vote was split.
+func mergeVotes(samples []map[int][]SectionAssignment, allowed map[string]bool) (map[int][]SectionAssignment, map[int]bool) {
+	n := len(samples)
+	votes := map[int]map[string]*agentVotes{}
+	for _, classified := range samples {
+		for sectionID, assignments := range classified {
+			if votes[sectionID] == nil {
+				votes[sectionID] = map[string]*agentVotes{}
+			}
+			seen := map[string]bool{}
+			for _, a := range normalizeAssignments(assignments, allowed) {
+				if seen[a.Agent] {
+					continue
+				}
+				seen[a.Agent] = true
+				v := votes[sectionID][a.Agent]
+				if v == nil {
+					v = &agentVotes{first: map[string]SectionAssignment{}}
+					votes[sectionID][a.Agent] = v
+				}
+				if _, ok := v.first[a.Relevance]; !ok {
+					v.first[a.Relevance] = a
+				}
+				if a.Relevance == "priority" {
+					v.priority++
+				} else {
+					v.context++
+				}
+			}
+		}
+	}
+
+	merged := make(map[int][]SectionAssignment, len(votes))
+	disagreements := map[int]bool{}
+	for sectionID, byAgent := range votes {
+		names := make([]string, 0, len(byAgent))
+		for name := range byAgent {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			v := byAgent[name]
+			total := v.priority + v.context
+			if total != n || (v.priority > 0 && v.context > 0) {
+				disagreements[sectionID] = true
+			}
+			if total*2 <= n {
+				continue
+			}
+			relevance := "context"
+			if v.priority > v.context {
+				relevance = "priority"
+			}
+			merged[sectionID] = append(merged[sectionID], SectionAssignment{
+				Agent:      name,
+				Relevance:  relevance,
+				Confidence: float64(total) / float64(n),
+				Rationale:  v.first[relevance].Rationale,
+				Evidence:   v.first[relevance].Evidence,
+			})
+		}
+	}
+	return merged, disagreements
+}
@@ -0,0 +1,75 @@
+package classify
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mistakeknot/interserve/internal/dispatch"
+	"github.com/mistakeknot/interserve/internal/extract"
+)
+
+func TestMergeVotesMajorityAndAgreementConfidence(t *testing.T) {
+	allowed := allowedAgents(DefaultAgents())
+	samples := []map[int][]SectionAssignment{
+		{1: {{Agent: "fd-safety", Relevance: "priority", Confidence: 0.99}, {Agent: "fd-performance", Relevance: "context"}}},
+		{1: {{Agent: "fd-safety", Relevance: "priority", Confidence: 0.5}}},
+		{1: {{Agent: "fd-safety", Relevance: "context", Confidence: 0.1}}, 2: {{Agent: "fd-correctness", Relevance: "priority"}}},
+	}
+
+	merged, disagreements := mergeVotes(samples, allowed)
+
+	if got := merged[1]; len(got) != 1 || got[0].Agent != "fd-safety" || got[0].Relevance != "priority" || got[0].Confidence != 1 {
+		t.Fatalf("unexpected section 1 merge %+v", got)
+	}
+	if len(merged[2]) != 0 {
+		t.Fatalf("minority assignment should be dropped, got %+v", merged[2])
+	}
+	if !disagreements[1] || !disagreements[2] {
+		t.Fatalf("expected both sections flagged, got %v", disagreements)
+	}
+}
+
+func TestMergeVotesUnanimousNotFlagged(t *testing.T) {
+	allowed := allowedAgents(DefaultAgents())
+	one := map[int][]SectionAssignment{1: {{Agent: "fd-safety", Relevance: "priority", Confidence: 0.3}}}
+	merged, disagreements := mergeVotes([]map[int][]SectionAssignment{one, one}, allowed)
+
+	if disagreements[1] {
+		t.Fatal("unanimous section should not be flagged")
+	}
+	if merged[1][0].Confidence != 1 {
+		t.Fatalf("unanimous confidence should be 1, got %v", merged[1][0].Confidence)
+	}
+}
+
+func TestClassifyEnsembleRunsSamplesConcurrently(t *testing.T) {
+	sections := []extract.Section{
+		{ID: 1, Heading: "Auth", LineCount: 50},
+		{ID: 2, Heading: "Misc", LineCount: 50},
+	}
+	var calls int32
+	d := dispatch.Func(func(ctx context.Context, req dispatch.Request) (dispatch.Response, error) {
+		if atomic.AddInt32(&calls, 1) == 3 {
+			return dispatch.Response{Output: `{"sections":[{"section_id":2,"assignments":[{"agent":"fd-safety","relevance":"priority","confidence":1}]}]}`}, nil
+		}
+		return dispatch.Response{Output: `{"sections":[{"section_id":1,"assignments":[{"agent":"fd-safety","relevance":"priority","confidence":0.4}]}]}`}, nil
+	})
+
+	result := Classify(context.Background(), d, sections, DefaultAgents(), Options{Samples: 3, DisableEscalation: true})
+	if result.Status != "success" {
+		t.Fatalf("expected success, got %q: %s", result.Status, result.Error)
+	}
+	if calls != 3 || result.Samples != 3 || result.Attempts != 3 {
+		t.Fatalf("expected 3 samples, got calls=%d samples=%d attempts=%d", calls, result.Samples, result.Attempts)
+	}
+	if got := result.SlicingMap["fd-safety"].PrioritySections; len(got) != 1 || got[0] != 1 {
+		t.Fatalf("expected majority to route section 1 only, got %v", got)
+	}
+	if !result.Sections[0].Disagreement || !result.Sections[1].Disagreement {
+		t.Fatalf("expected split votes to be flagged: %+v", result.Sections)
+	}
+	if conf := result.Sections[0].Assignments[0].Confidence; conf < 0.66 || conf > 0.67 {
+		t.Fatalf("expected agreement confidence 2/3, got %v", conf)
+	}
+}
@@ -0,0 +1,40 @@
+package classify
+
+import (
+	"fmt"
+	"strings"
+)
+
+// escalationReason reports why a fast-tier result should be retried on the
+// deep tier, or "" when it should be kept. Dispatch and parse failures are not
+// escalated: a stronger model does not fix a broken backend.
+func escalationReason(result ClassifyResult, opts Options) string {
+	if opts.DisableEscalation {
+		return ""
+	}
+	if strings.HasPrefix(result.Error, errDomainMismatch) {
+		return result.Error
+	}
+	if result.Status != statusSuccess || opts.EscalationMinConfidence <= 0 {
+		return ""
+	}
+	if avg := averageConfidence(result.Sections); avg < opts.EscalationMinConfidence {
+		return fmt.Sprintf("average confidence %.2f below %.2f", avg, opts.EscalationMinConfidence)
+	}
+	return ""
+}
+
+func averageConfidence(sections []ClassifiedSection) float64 {
+	total := 0.0
+	count := 0
+	for _, section := range sections {
+		for _, assignment := range section.Assignments {
+			total += assignment.Confidence
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return total / float64(count)
+}
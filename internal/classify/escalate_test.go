@@ -0,0 +1,82 @@
+package classify
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mistakeknot/interserve/internal/dispatch"
+	"github.com/mistakeknot/interserve/internal/extract"
+)
+
+func tieredDispatcher(outputs map[string]string, tiers *[]string) dispatch.Dispatcher {
+	return dispatch.Func(func(ctx context.Context, req dispatch.Request) (dispatch.Response, error) {
+		*tiers = append(*tiers, req.Tier)
+		return dispatch.Response{Output: outputs[req.Tier]}, nil
+	})
+}
+
+func escalationSections() []extract.Section {
+	return []extract.Section{
+		{ID: 1, Heading: "Auth", LineCount: 50},
+		{ID: 2, Heading: "Misc", LineCount: 50},
+	}
+}
+
+func TestClassifyEscalatesOnDomainMismatch(t *testing.T) {
+	var tiers []string
+	d := tieredDispatcher(map[string]string{
+		dispatch.TierFast: `{"sections":[]}`,
+		dispatch.TierDeep: `{"sections":[{"section_id":1,"assignments":[{"agent":"fd-safety","relevance":"priority","confidence":0.9}]}]}`,
+	}, &tiers)
+
+	result := Classify(context.Background(), d, escalationSections(), DefaultAgents(), DefaultOptions())
+	if result.Status != "success" || result.Tier != dispatch.TierDeep {
+		t.Fatalf("expected deep-tier success, got %q on %q: %s", result.Status, result.Tier, result.Error)
+	}
+	if !result.Escalated || !strings.HasPrefix(result.EscalationReason, errDomainMismatch) {
+		t.Fatalf("expected domain mismatch escalation, got %v %q", result.Escalated, result.EscalationReason)
+	}
+	if strings.Join(tiers, ",") != "fast,deep" || result.Attempts != 2 {
+		t.Fatalf("unexpected dispatch sequence %v (attempts %d)", tiers, result.Attempts)
+	}
+}
+
+func TestClassifyEscalatesOnLowConfidence(t *testing.T) {
+	var tiers []string
+	d := tieredDispatcher(map[string]string{
+		dispatch.TierFast: `{"sections":[{"section_id":1,"assignments":[{"agent":"fd-safety","relevance":"priority","confidence":0.2}]}]}`,
+		dispatch.TierDeep: `{"sections":[{"section_id":1,"assignments":[{"agent":"fd-safety","relevance":"priority","confidence":0.9}]}]}`,
+	}, &tiers)
+
+	result := Classify(context.Background(), d, escalationSections(), DefaultAgents(), Options{EscalationMinConfidence: 0.5})
+	if result.Tier != dispatch.TierDeep || !strings.Contains(result.EscalationReason, "average confidence 0.20") {
+		t.Fatalf("expected confidence escalation, got tier %q reason %q", result.Tier, result.EscalationReason)
+	}
+}
+
+func TestClassifyKeepsFastResultWhenDeepFails(t *testing.T) {
+	var tiers []string
+	d := tieredDispatcher(map[string]string{
+		dispatch.TierFast: `{"sections":[{"section_id":1,"assignments":[{"agent":"fd-safety","relevance":"priority","confidence":0.2}]}]}`,
+		dispatch.TierDeep: "",
+	}, &tiers)
+
+	result := Classify(context.Background(), d, escalationSections(), DefaultAgents(), Options{EscalationMinConfidence: 0.5})
+	if result.Status != "success" || result.Tier != dispatch.TierFast {
+		t.Fatalf("expected fast-tier success to survive, got %q on %q", result.Status, result.Tier)
+	}
+	if !result.Escalated || !strings.Contains(result.EscalationReason, "deep tier failed") {
+		t.Fatalf("expected failed escalation to be reported, got %q", result.EscalationReason)
+	}
+}
+
+func TestClassifyEscalationDisabled(t *testing.T) {
+	var tiers []string
+	d := tieredDispatcher(map[string]string{dispatch.TierFast: `{"sections":[]}`}, &tiers)
+
+	result := Classify(context.Background(), d, escalationSections(), DefaultAgents(), Options{DisableEscalation: true})
+	if result.Escalated || len(tiers) != 1 || result.Tier != dispatch.TierFast {
+		t.Fatalf("expected single fast dispatch, got tiers %v escalated %v", tiers, result.Escalated)
+	}
+}
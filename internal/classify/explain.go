@@ -0,0 +1,90 @@
+package classify
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mistakeknot/interserve/internal/extract"
+)
+
+// Rules recorded in ClassifyResult.Decisions.
+const (
+	ruleNormalization         = "normalization"
+	ruleMinConfidence         = "min_confidence"
+	ruleMinPriorityConfidence = "min_priority_confidence"
+	ruleMismatchGuard         = "mismatch_guard"
+	ruleFullDocument          = "full_document"
+	ruleTokenBudget           = "token_budget"
+)
+
+// maxEvidence caps the quoted lines kept per assignment.
+const maxEvidence = 3
+
+// Decision records a rule that changed the classification after the model (or
+// the local scorer) answered: an assignment dropped or demoted, a slice
+// widened to the whole document or trimmed to its budget.
+type Decision struct {
+	Rule      string `json:"rule"`
+	SectionID int    `json:"section_id,omitempty"`
+	Agent     string `json:"agent,omitempty"`
+	Detail    string `json:"detail"`
+}
+
+// checkEvidence keeps the evidence lines that are quoted from section,
+// ignoring differences in whitespace, up to maxEvidence. Each line dropped
+// produces a warning.
+func checkEvidence(evidence []string, section extract.Section) ([]string, []string) {
+	text := collapseSpace(section.Heading + "\n" + section.Body)
+	var kept []string
+	var warnings []string
+	for _, line := range evidence {
+		quoted := collapseSpace(line)
+		switch {
+		case quoted == "":
+			continue
+		case !strings.Contains(text, quoted):
+			warnings = append(warnings, fmt.Sprintf("evidence %q is not quoted from the section; dropped", line))
+		case len(kept) == maxEvidence:
+			warnings = append(warnings, fmt.Sprintf("evidence beyond %d lines dropped", maxEvidence))
+			return kept, warnings
+		default:
+			kept = append(kept, strings.TrimSpace(line))
+		}
+	}
+	return kept, warnings
+}
+
+// localExplanation explains a local score: the section words that matched the
+// agent's profile and up to maxEvidence lines containing them.
+func localExplanation(section extract.Section, profile map[string]float64) (string, []string) {
+	var words, evidence []string
+	seen := map[string]bool{}
+	lines := append([]string{section.Heading}, strings.Split(section.Body, "\n")...)
+	for _, line := range lines {
+		matched := false
+		for _, word := range strings.FieldsFunc(strings.ToLower(line), notWordRune) {
+			if len([]rune(word)) < 3 || stopwords[word] || profile[stem(word)] == 0 {
+				continue
+			}
+			matched = true
+			if !seen[word] {
+				seen[word] = true
+				words = append(words, word)
+			}
+		}
+		if matched && len(evidence) < maxEvidence {
+			evidence = append(evidence, strings.TrimSpace(line))
+		}
+	}
+	if len(words) == 0 {
+		return "", nil
+	}
+	if len(words) > 5 {
+		words = words[:5]
+	}
+	return "mentions " + strings.Join(words, ", "), evidence
+}
+
+func collapseSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
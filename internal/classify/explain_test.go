@@ -0,0 +1,140 @@
+package classify
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mistakeknot/interserve/internal/extract"
+)
+
+func TestCheckEvidenceKeepsOnlyQuotedLines(t *testing.T) {
+	section := extract.Section{ID: 1, Heading: "Threat model", Body: "Stolen tokens let an attacker\nact as the user.\nTokens are revoked on logout."}
+	kept, warnings := checkEvidence([]string{
+		"  Tokens are   revoked on logout. ",
+		"Stolen tokens let an attacker act as the user.",
+		"Tokens never expire.",
+		"",
+	}, section)
+
+	want := []string{"Tokens are   revoked on logout.", "Stolen tokens let an attacker act as the user."}
+	if !reflect.DeepEqual(kept, want) {
+		t.Fatalf("kept = %q, want %q", kept, want)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "Tokens never expire.") {
+		t.Fatalf("expected one warning for the unquoted line, got %q", warnings)
+	}
+}
+
+func TestCheckEvidenceCapsLines(t *testing.T) {
+	section := extract.Section{ID: 1, Heading: "H", Body: "a\nb\nc\nd"}
+	kept, warnings := checkEvidence([]string{"a", "b", "c", "d"}, section)
+	if len(kept) != maxEvidence || len(warnings) != 1 {
+		t.Fatalf("expected %d lines and one warning, got %q and %q", maxEvidence, kept, warnings)
+	}
+}
+
+func TestBuildResultRecordsDecisions(t *testing.T) {
+	sections := []extract.Section{
+		{ID: 1, Heading: "Auth", LineCount: 90, Body: strings.Repeat("x", 400)},
+		{ID: 2, Heading: "Perf", LineCount: 10, Body: strings.Repeat("x", 40)},
+	}
+	agents := []AgentDomain{
+		{Name: "fd-safety", TokenBudget: 50},
+		{Name: "fd-performance", MinConfidence: 0.5},
+		{Name: "fd-correctness"},
+	}
+	classified := map[int][]SectionAssignment{
+		1: {
+			{Agent: "fd-safety", Relevance: "priority", Confidence: 0.9},
+			{Agent: "fd-correctness", Relevance: "priority", Confidence: 0.2},
+		},
+		2: {{Agent: "fd-performance", Relevance: "priority", Confidence: 0.4}},
+	}
+	policy := DefaultSlicingPolicy()
+	policy.MinPriorityConfidence = 0.3
+
+	result := buildResult(classified, sections, agents, policy, 0)
+	if result.Status != "success" {
+		t.Fatalf("expected success, got %q: %s", result.Status, result.Error)
+	}
+
+	var got []string
+	for _, d := range result.Decisions {
+		got = append(got, d.Rule+":"+d.Agent)
+	}
+	want := []string{
+		"min_priority_confidence:fd-correctness",
+		"min_confidence:fd-performance",
+		"full_document:fd-safety",
+		"token_budget:fd-safety",
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("decisions = %q, want %q", got, want)
+	}
+	if d := result.Decisions[2]; !strings.Contains(d.Detail, "90% of lines") || !strings.Contains(d.Detail, "80%") {
+		t.Fatalf("full document decision should explain the ceiling: %q", d.Detail)
+	}
+}
+
+func TestBuildResultRecordsMismatchGuard(t *testing.T) {
+	sections := []extract.Section{{ID: 1, Heading: "Intro", LineCount: 10}}
+	result := buildResult(map[int][]SectionAssignment{}, sections, DefaultAgents(), DefaultSlicingPolicy(), 0)
+	if len(result.Decisions) != 1 || result.Decisions[0].Rule != "mismatch_guard" || result.Decisions[0].Detail != result.Error {
+		t.Fatalf("expected a mismatch guard decision carrying the error, got %+v", result.Decisions)
+	}
+}
+
+func TestValidateResponseRecordsNormalizationDrops(t *testing.T) {
+	sections := []extract.Section{{ID: 1, Heading: "Auth", Body: "Tokens are revoked on logout."}}
+	decoded, err := parseDispatchResponse(`{"sections":[
+		{"section_id":1,"assignments":[
+			{"agent":"fd-safety","relevance":"priority","confidence":0.9,"rationale":" Covers revocation. ","evidence":["Tokens are revoked on logout.","Made up."]},
+			{"agent":"fd-unknown","relevance":"priority","confidence":0.9}
+		]},
+		{"section_id":4,"assignments":[]}
+	]}`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	classified, warnings, decisions := validateResponse(decoded, sections, DefaultAgents())
+	want := SectionAssignment{Agent: "fd-safety", Relevance: "priority", Confidence: 0.9, Rationale: "Covers revocation.", Evidence: []string{"Tokens are revoked on logout."}}
+	if len(classified[1]) != 1 || !reflect.DeepEqual(classified[1][0], want) {
+		t.Fatalf("got %+v, want %+v", classified[1], want)
+	}
+	if !slices.ContainsFunc(warnings, func(w string) bool { return strings.Contains(w, `evidence "Made up." is not quoted`) }) {
+		t.Fatalf("expected an evidence warning, got %q", warnings)
+	}
+	if len(decisions) != 2 || decisions[0].Agent != "fd-unknown" || decisions[1].SectionID != 4 {
+		t.Fatalf("expected drops for the unknown agent and missing section, got %+v", decisions)
+	}
+	for _, d := range decisions {
+		if d.Rule != "normalization" {
+			t.Fatalf("unexpected rule %q", d.Rule)
+		}
+	}
+}
+
+func TestClassifyLocalExplainsMatches(t *testing.T) {
+	sections := planSections(t)
+	for _, a := range classifyLocal(sections, DefaultAgents())[2] {
+		if a.Agent != "fd-safety" {
+			continue
+		}
+		if !strings.HasPrefix(a.Rationale, "mentions ") || !strings.Contains(a.Rationale, "attacker") {
+			t.Fatalf("expected rationale naming matched words, got %q", a.Rationale)
+		}
+		if len(a.Evidence) == 0 || len(a.Evidence) > maxEvidence {
+			t.Fatalf("expected 1..%d evidence lines, got %q", maxEvidence, a.Evidence)
+		}
+		for _, line := range a.Evidence {
+			if !strings.Contains(sections[1].Heading+"\n"+sections[1].Body, line) {
+				t.Fatalf("evidence %q is not from the section", line)
+			}
+		}
+		return
+	}
+	t.Fatal("expected fd-safety on the threat model section")
+}
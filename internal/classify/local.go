@@ -0,0 +1,145 @@
+package classify
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/mistakeknot/interserve/internal/extract"
+)
+
+const (
+	// headingWeight counts heading terms this many times over body terms.
+	headingWeight = 3
+	// keywordWeight scales explicit keywords over words from the description.
+	keywordWeight = 2.0
+	// localScoreScale maps a TF-IDF score onto (0, 1): confidence = 1 - e^(-score/scale).
+	localScoreScale = 6.0
+
+	localPriorityConfidence = 0.6
+	localContextConfidence  = 0.3
+)
+
+// stopwords are dropped from descriptions and section text before scoring.
+var stopwords = map[string]bool{
+	"and": true, "are": true, "but": true, "for": true, "from": true, "has": true,
+	"have": true, "how": true, "into": true, "its": true, "not": true, "that": true,
+	"the": true, "their": true, "then": true, "there": true, "this": true, "was": true,
+	"were": true, "what": true, "when": true, "which": true, "who": true, "will": true,
+	"with": true, "you": true, "your": true, "all": true, "any": true, "can": true,
+	"should": true, "must": true, "each": true, "other": true, "our": true, "use": true,
+}
+
+// classifyLocal scores every section against every agent's description and
+// keywords with TF-IDF over the document's sections. It needs no backend and
+// is deterministic. Confidence rises with the score; sections scoring at least
+// localPriorityConfidence become priority and at least localContextConfidence
+// become context. The rationale names the words that matched and the evidence
+// is the lines they appear on.
+func classifyLocal(sections []extract.Section, agents []AgentDomain) map[int][]SectionAssignment {
+	termFreqs := make([]map[string]int, len(sections))
+	docFreq := map[string]int{}
+	for i, section := range sections {
+		tf := map[string]int{}
+		for _, term := range terms(section.Heading) {
+			tf[term] += headingWeight
+		}
+		for _, term := range terms(section.Body) {
+			tf[term]++
+		}
+		for term := range tf {
+			docFreq[term]++
+		}
+		termFreqs[i] = tf
+	}
+
+	n := float64(len(sections))
+	classified := make(map[int][]SectionAssignment, len(sections))
+	for _, agent := range agents {
+		profile := agentProfile(agent)
+		for i, section := range sections {
+			score := 0.0
+			for term, weight := range profile {
+				tf := termFreqs[i][term]
+				if tf == 0 {
+					continue
+				}
+				idf := math.Log((1+n)/(1+float64(docFreq[term]))) + 1
+				score += weight * (1 + math.Log(float64(tf))) * idf
+			}
+
+			confidence := math.Round((1-math.Exp(-score/localScoreScale))*100) / 100
+			relevance := ""
+			switch {
+			case confidence >= localPriorityConfidence:
+				relevance = "priority"
+			case confidence >= localContextConfidence:
+				relevance = "context"
+			default:
+				continue
+			}
+			rationale, evidence := localExplanation(section, profile)
+			classified[section.ID] = append(classified[section.ID], SectionAssignment{
+				Agent:      agent.Name,
+				Relevance:  relevance,
+				Confidence: confidence,
+				Rationale:  rationale,
+				Evidence:   evidence,
+			})
+		}
+	}
+
+	for id, assignments := range classified {
+		sort.SliceStable(assignments, func(i, j int) bool {
+			return assignments[i].Confidence > assignments[j].Confidence
+		})
+		classified[id] = assignments
+	}
+	return classified
+}
+
+// agentProfile weights the terms that indicate agent: description words at 1,
+// keyword terms at keywordWeight.
+func agentProfile(agent AgentDomain) map[string]float64 {
+	profile := map[string]float64{}
+	for _, term := range terms(agent.Description) {
+		profile[term] = max(profile[term], 1)
+	}
+	for _, keyword := range agent.Keywords {
+		for _, term := range terms(keyword) {
+			profile[term] = keywordWeight
+		}
+	}
+	return profile
+}
+
+// terms lowercases s and splits it into stemmed words of three or more
+// characters, skipping stopwords.
+func terms(s string) []string {
+	words := strings.FieldsFunc(strings.ToLower(s), notWordRune)
+	out := words[:0]
+	for _, word := range words {
+		if len([]rune(word)) < 3 || stopwords[word] {
+			continue
+		}
+		out = append(out, stem(word))
+	}
+	return out
+}
+
+func notWordRune(r rune) bool {
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+}
+
+// stem strips one common English suffix so "latency"/"latencies" and
+// "scale"/"scaling" meet. It is deliberately crude: both sides of every
+// comparison go through it.
+func stem(word string) string {
+	for _, suffix := range []string{"ies", "ing", "ed", "es", "s", "y", "e"} {
+		if strings.HasSuffix(word, suffix) && len(word)-len(suffix) >= 3 {
+			return strings.TrimSuffix(word, suffix)
+		}
+	}
+	return word
+}
@@ -0,0 +1,154 @@
+package classify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mistakeknot/interserve/internal/dispatch"
+	"github.com/mistakeknot/interserve/internal/extract"
+)
+
+func planSections(t *testing.T) []extract.Section {
+	t.Helper()
+	doc, err := os.ReadFile("testdata/plan.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return extract.ExtractSections(string(doc))
+}
+
+func TestClassifyLocalRoutesPlan(t *testing.T) {
+	result := Classify(context.Background(), nil, planSections(t), DefaultAgents(), Options{Method: MethodLocal})
+	if result.Status != "success" || result.Method != "local" {
+		t.Fatalf("expected local success, got %q via %q: %s", result.Status, result.Method, result.Error)
+	}
+
+	want := map[string][]int{
+		"fd-safety":      {2},
+		"fd-correctness": {3},
+		"fd-performance": {4},
+		"fd-game-design": {},
+	}
+	for agent, sections := range want {
+		if got := result.SlicingMap[agent].PrioritySections; !slices.Equal(got, sections) {
+			t.Errorf("%s priority sections = %v, want %v", agent, got, sections)
+		}
+	}
+}
+
+func TestClassifyLocalIsDeterministic(t *testing.T) {
+	sections := planSections(t)
+	first := classifyLocal(sections, DefaultAgents())
+	for i := 0; i < 5; i++ {
+		again := classifyLocal(sections, DefaultAgents())
+		for id, assignments := range first {
+			if !reflect.DeepEqual(assignments, again[id]) {
+				t.Fatalf("section %d changed between runs: %+v vs %+v", id, assignments, again[id])
+			}
+		}
+	}
+}
+
+func TestClassifyLocalUsesCustomKeywords(t *testing.T) {
+	sections := []extract.Section{
+		{ID: 1, Heading: "Shard layout", Body: "Rows are partitioned by tenant shard.", LineCount: 10},
+		{ID: 2, Heading: "Naming", Body: "Names follow the style guide.", LineCount: 10},
+	}
+	agents := []AgentDomain{{Name: "fd-data", Description: "Storage design.", Keywords: []string{"shard", "partition"}}}
+
+	classified := classifyLocal(sections, agents)
+	if len(classified[1]) != 1 || classified[1][0].Agent != "fd-data" || classified[1][0].Relevance != "priority" {
+		t.Fatalf("expected keyword match to prioritize section 1, got %+v", classified[1])
+	}
+	if len(classified[2]) != 0 {
+		t.Fatalf("unrelated section should be unassigned, got %+v", classified[2])
+	}
+}
+
+func TestClassifyFallsBackToLocalWhenDispatchFails(t *testing.T) {
+	d := dispatch.Func(func(ctx context.Context, req dispatch.Request) (dispatch.Response, error) {
+		return dispatch.Response{}, errors.New("dispatch.sh: exit status 1")
+	})
+
+	result := Classify(context.Background(), d, planSections(t), DefaultAgents(), DefaultOptions())
+	if result.Status != "success" || result.Method != "local" {
+		t.Fatalf("expected local fallback success, got %q via %q: %s", result.Status, result.Method, result.Error)
+	}
+	if !strings.Contains(result.FallbackReason, "exit status 1") {
+		t.Fatalf("fallback reason should carry the dispatch error, got %q", result.FallbackReason)
+	}
+	if result.Attempts != 1 {
+		t.Fatalf("dispatch attempts should still be reported, got %d", result.Attempts)
+	}
+
+	opts := DefaultOptions()
+	opts.LocalFallback = false
+	if result := Classify(context.Background(), d, planSections(t), DefaultAgents(), opts); result.Status == "success" {
+		t.Fatal("fallback disabled: dispatch failure should be reported")
+	}
+}
+
+func TestClassifyLocalFallbackKeepsOpenCircuitVisible(t *testing.T) {
+	breaker := dispatch.NewBreaker(1, time.Minute)
+	d := dispatch.Chain(dispatch.Func(func(ctx context.Context, req dispatch.Request) (dispatch.Response, error) {
+		return dispatch.Response{}, errors.New("dispatch.sh: exit status 1")
+	}), breaker.Middleware())
+	_, _ = d.Dispatch(context.Background(), dispatch.Request{})
+
+	result := Classify(context.Background(), d, planSections(t), DefaultAgents(), DefaultOptions())
+	if result.Status != "success" || result.Method != "local" {
+		t.Fatalf("expected local fallback success, got %q via %q: %s", result.Status, result.Method, result.Error)
+	}
+	if result.DispatchStatus != "backend_unavailable" {
+		t.Fatalf("dispatch_status should report the open circuit, got %q", result.DispatchStatus)
+	}
+	if result.RetryAfterMs <= 0 || result.RetryAfterMs > time.Minute.Milliseconds() {
+		t.Fatalf("retry_after_ms should carry the breaker's hint, got %d", result.RetryAfterMs)
+	}
+	if result.Tier != dispatch.TierFast {
+		t.Fatalf("tier of the failed dispatch should be kept, got %q", result.Tier)
+	}
+}
+
+func TestClassifyDoesNotFallBackOnDomainMismatch(t *testing.T) {
+	sections := planSections(t)
+	var b strings.Builder
+	b.WriteString(`{"sections":[`)
+	for i, section := range sections {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		fmt.Fprintf(&b, `{"section_id":%d,"assignments":[]}`, section.ID)
+	}
+	b.WriteString(`]}`)
+	d := dispatch.Func(func(ctx context.Context, req dispatch.Request) (dispatch.Response, error) {
+		return dispatch.Response{Output: b.String()}, nil
+	})
+
+	result := Classify(context.Background(), d, sections, DefaultAgents(), DefaultOptions())
+	if result.Method != "dispatch" || !strings.HasPrefix(result.Error, "domain mismatch") || result.DispatchStatus != "" {
+		t.Fatalf("expected the model's domain mismatch, got %q via %q: %s", result.Status, result.Method, result.Error)
+	}
+}
+
+func TestClassifyRejectsUnknownMethod(t *testing.T) {
+	result := Classify(context.Background(), nil, planSections(t), DefaultAgents(), Options{Method: "magic"})
+	if result.Status != "no_classification" || !strings.Contains(result.Error, "invalid method") {
+		t.Fatalf("expected invalid method error, got %q: %s", result.Status, result.Error)
+	}
+}
+
+func TestStemJoinsInflections(t *testing.T) {
+	for _, pair := range [][2]string{{"latency", "latencies"}, {"scale", "scaling"}, {"token", "tokens"}} {
+		if stem(pair[0]) != stem(pair[1]) {
+			t.Errorf("stem(%q)=%q, stem(%q)=%q", pair[0], stem(pair[0]), pair[1], stem(pair[1]))
+		}
+	}
+}
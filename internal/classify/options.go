@@ -0,0 +1,48 @@
+package classify
+
+// DefaultEscalationMinConfidence is the average assignment confidence below
+// which a fast-tier classification is retried on the deep tier.
+const DefaultEscalationMinConfidence = 0.5
+
+const (
+	// MethodDispatch classifies with a model via the dispatcher.
+	MethodDispatch = "dispatch"
+	// MethodLocal classifies with the deterministic keyword/TF-IDF scorer.
+	MethodLocal = "local"
+)
+
+// Options tunes a single Classify call.
+type Options struct {
+	// DisableEscalation keeps classification on the fast tier.
+	DisableEscalation bool
+	// EscalationMinConfidence is the average-confidence floor for fast-tier
+	// results. Zero disables the confidence check; the domain mismatch guard
+	// still escalates.
+	EscalationMinConfidence float64
+	// Samples is the number of concurrent dispatches merged by majority vote.
+	// Values below 2 run a single dispatch; values above MaxSamples are capped.
+	Samples int
+	// Method is MethodDispatch (the default when empty) or MethodLocal.
+	Method string
+	// LocalFallback classifies locally when the dispatched classification
+	// fails, so routing degrades instead of returning nothing.
+	LocalFallback bool
+	// Slicing overrides DefaultSlicingPolicy for this call; agents' own
+	// overrides apply on top.
+	Slicing PolicyOverride
+	// TokenBudget caps the estimated tokens of each agent's priority sections
+	// for agents without their own AgentDomain.TokenBudget. Zero is unlimited.
+	TokenBudget int
+	// Cache, when set, reuses earlier assignments for sections whose content
+	// and agent set it has seen, and dispatches only the rest.
+	Cache *Cache
+}
+
+// DefaultOptions returns the options used by the MCP tools.
+func DefaultOptions() Options {
+	return Options{EscalationMinConfidence: DefaultEscalationMinConfidence, LocalFallback: true}
+}
+
+func (o Options) slicingPolicy() SlicingPolicy {
+	return DefaultSlicingPolicy().Apply(&o.Slicing)
+}
@@ -0,0 +1,191 @@
+package classify
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	errEmptyOutput  = errors.New("empty classification output")
+	errNoJSONObject = errors.New("no JSON object found in output")
+	errNoSections   = errors.New(`JSON object has no top-level "sections" key`)
+)
+
+// parseDispatchResponse decodes the first usable JSON object from raw model
+// output: one with a top-level "sections" key. Chatty preambles, markdown
+// fences, comments and trailing commas are tolerated. Objects nested in a
+// candidate that fails are not tried, so truncated output is a parse error
+// rather than an inner object read as an empty classification. The error for
+// the first candidate is returned if none parse.
+func parseDispatchResponse(raw string) (dispatchResponse, error) {
+	if strings.TrimSpace(raw) == "" {
+		return dispatchResponse{}, errEmptyOutput
+	}
+
+	var firstErr error
+	for offset := 0; offset < len(raw); {
+		candidate, start, ok := extractJSONObject(raw[offset:])
+		if !ok {
+			break
+		}
+		offset += start + len(candidate)
+
+		decoded, err := decodeCandidate(candidate)
+		if err != nil {
+			decoded, err = decodeCandidate(repairJSON(candidate))
+		}
+		if err == nil {
+			return decoded, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if firstErr == nil {
+		return dispatchResponse{}, errNoJSONObject
+	}
+	return dispatchResponse{}, firstErr
+}
+
+// decodeCandidate decodes a classification object, requiring a top-level
+// "sections" key.
+func decodeCandidate(candidate string) (dispatchResponse, error) {
+	var probe struct {
+		Sections json.RawMessage `json:"sections"`
+	}
+	if err := json.Unmarshal([]byte(candidate), &probe); err != nil {
+		return dispatchResponse{}, err
+	}
+	if probe.Sections == nil {
+		return dispatchResponse{}, errNoSections
+	}
+	var decoded dispatchResponse
+	if err := json.Unmarshal([]byte(candidate), &decoded); err != nil {
+		return dispatchResponse{}, err
+	}
+	return decoded, nil
+}
+
+// extractJSONObject returns the first balanced {...} span in s and its start
+// offset. Braces inside JSON strings are ignored. An unbalanced trailing object
+// is returned as-is so the decoder can report a precise error.
+func extractJSONObject(s string) (string, int, bool) {
+	start := strings.IndexByte(s, '{')
+	if start < 0 {
+		return "", 0, false
+	}
+
+	depth := 0
+	inString := false
+	escaped := false
+	for i := start; i < len(s); i++ {
+		c := s[i]
+		if inString {
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+		switch c {
+		case '"':
+			inString = true
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return s[start : i+1], start, true
+			}
+		}
+	}
+	return s[start:], start, true
+}
+
+// repairJSON strips // and /* */ comments and trailing commas outside strings.
+func repairJSON(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+
+	inString := false
+	escaped := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if inString {
+			b.WriteByte(c)
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			}
+			continue
+		}
+
+		switch {
+		case c == '"':
+			inString = true
+			b.WriteByte(c)
+		case c == '/' && i+1 < len(s) && s[i+1] == '/':
+			for i < len(s) && s[i] != '\n' {
+				i++
+			}
+			if i < len(s) {
+				b.WriteByte('\n')
+			}
+		case c == '/' && i+1 < len(s) && s[i+1] == '*':
+			end := strings.Index(s[i+2:], "*/")
+			if end < 0 {
+				i = len(s)
+			} else {
+				i += end + 3
+			}
+		case c == ',':
+			j := i + 1
+			for j < len(s) && isJSONSpace(s[j]) {
+				j++
+			}
+			if j < len(s) && (s[j] == '}' || s[j] == ']') {
+				continue
+			}
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+func isJSONSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// BuildRepairPrompt asks the model to re-emit its classification after a parse failure.
+func BuildRepairPrompt(original, previousOutput string, parseErr error) string {
+	var b strings.Builder
+	b.WriteString(original)
+	b.WriteString("\nYour previous response could not be parsed as JSON.\n")
+	fmt.Fprintf(&b, "Parse error: %v\n", parseErr)
+	b.WriteString("Previous response:\n")
+	b.WriteString(truncateRunes(strings.TrimSpace(previousOutput), 2000))
+	b.WriteString("\n\nReturn ONLY the corrected JSON object matching the schema above. ")
+	b.WriteString("No prose, no markdown fences, no comments, no trailing commas.\n")
+	return b.String()
+}
+
+func truncateRunes(s string, max int) string {
+	r := []rune(s)
+	if len(r) <= max {
+		return s
+	}
+	return string(r[:max]) + " [truncated]"
+}
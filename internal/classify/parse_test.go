@@ -0,0 +1,124 @@
+package classify
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/mistakeknot/interserve/internal/dispatch"
+	"github.com/mistakeknot/interserve/internal/extract"
+)
+
+func TestParseDispatchResponseTolerantInputs(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"plain", `{"sections":[{"section_id":1,"assignments":[]}]}`},
+		{"leading fence", "```json\n{\"sections\":[{\"section_id\":1}]}\n```"},
+		{"chatty preamble and trailer", "Sure! Here is the result:\n```json\n{\"sections\":[{\"section_id\":1}]}\n```\nLet me know if you need more."},
+		{"trailing commas", `{"sections":[{"section_id":1,"assignments":[],},],}`},
+		{"comments", "{\n// classified\n\"sections\": [ /* one */ {\"section_id\": 1}]\n}"},
+		{"braces in prose before JSON", "Use {curly} braces.\n{\"sections\":[{\"section_id\":1}]}"},
+		{"braces inside strings", `{"sections":[{"section_id":1,"assignments":[{"agent":"fd-}safety{","relevance":"priority"}]}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded, err := parseDispatchResponse(tt.input)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if len(decoded.Sections) != 1 || decoded.Sections[0].SectionID != 1 {
+				t.Fatalf("unexpected decode %+v", decoded)
+			}
+		})
+	}
+}
+
+func TestParseDispatchResponseErrors(t *testing.T) {
+	if _, err := parseDispatchResponse("  \n"); !errors.Is(err, errEmptyOutput) {
+		t.Fatalf("expected errEmptyOutput, got %v", err)
+	}
+	if _, err := parseDispatchResponse("no json here"); !errors.Is(err, errNoJSONObject) {
+		t.Fatalf("expected errNoJSONObject, got %v", err)
+	}
+	if _, err := parseDispatchResponse(`{"sections": [`); err == nil {
+		t.Fatal("expected error for truncated object")
+	}
+	if _, err := parseDispatchResponse(`{"sections":[{"section_id":1,"assignments":[]}]`); err == nil {
+		t.Fatal("nested object of a truncated response should not be accepted")
+	}
+	if _, err := parseDispatchResponse(`{"section_id":1}`); !errors.Is(err, errNoSections) {
+		t.Fatalf("expected errNoSections, got %v", err)
+	}
+}
+
+func TestRepairJSONKeepsStringContents(t *testing.T) {
+	in := `{"a": "// not a comment, }", "b": [1,2,],}`
+	want := `{"a": "// not a comment, }", "b": [1,2]}`
+	if got := repairJSON(in); got != want {
+		t.Fatalf("repairJSON(%q) = %q, want %q", in, got, want)
+	}
+}
+
+func TestClassifyRetriesWithCorrectivePrompt(t *testing.T) {
+	sections := []extract.Section{{ID: 1, Heading: "Auth", Body: "tokens", LineCount: 10}}
+	var prompts []string
+	d := dispatch.Func(func(ctx context.Context, req dispatch.Request) (dispatch.Response, error) {
+		prompts = append(prompts, req.Prompt)
+		if len(prompts) == 1 {
+			return dispatch.Response{Output: "I think section 1 is about safety."}, nil
+		}
+		return dispatch.Response{Output: `{"sections":[{"section_id":1,"assignments":[{"agent":"fd-safety","relevance":"priority","confidence":0.8}]}]}`}, nil
+	})
+
+	result := Classify(context.Background(), d, sections, DefaultAgents(), Options{})
+	if result.Status != "success" {
+		t.Fatalf("expected success after repair, got %q: %s", result.Status, result.Error)
+	}
+	if result.Attempts != 2 {
+		t.Fatalf("expected 2 attempts, got %d", result.Attempts)
+	}
+	if len(prompts) != 2 || !strings.Contains(prompts[1], "could not be parsed") || !strings.Contains(prompts[1], "I think section 1") {
+		t.Fatalf("repair prompt missing parse feedback: %q", prompts[len(prompts)-1])
+	}
+}
+
+func TestClassifyGivesUpAfterOneRepair(t *testing.T) {
+	sections := []extract.Section{{ID: 1, Heading: "Auth", LineCount: 10}}
+	calls := 0
+	d := dispatch.Func(func(ctx context.Context, req dispatch.Request) (dispatch.Response, error) {
+		calls++
+		return dispatch.Response{Output: `{"sections": [`}, nil
+	})
+
+	result := Classify(context.Background(), d, sections, DefaultAgents(), Options{})
+	if result.Status != "no_classification" || !strings.Contains(result.Error, "invalid classification JSON") {
+		t.Fatalf("unexpected result %q: %s", result.Status, result.Error)
+	}
+	if calls != 2 || result.Attempts != 2 {
+		t.Fatalf("expected exactly 2 dispatches, got calls=%d attempts=%d", calls, result.Attempts)
+	}
+}
+
+func TestClassifyRepairsTruncatedOutput(t *testing.T) {
+	sections := []extract.Section{{ID: 1, Heading: "Auth", Body: "tokens", LineCount: 10}}
+	var prompts []string
+	d := dispatch.Func(func(ctx context.Context, req dispatch.Request) (dispatch.Response, error) {
+		prompts = append(prompts, req.Prompt)
+		if len(prompts) == 1 {
+			return dispatch.Response{Output: `{"sections":[{"section_id":1,"assignments":[{"agent":"fd-safety","relevance":"priority","confidence":0.8}]}]`}, nil
+		}
+		return dispatch.Response{Output: `{"sections":[{"section_id":1,"assignments":[{"agent":"fd-safety","relevance":"priority","confidence":0.8}]}]}`}, nil
+	})
+
+	result := Classify(context.Background(), d, sections, DefaultAgents(), Options{})
+	if result.Status != "success" || result.Attempts != 2 {
+		t.Fatalf("expected success on the repair attempt, got %q after %d attempts: %s", result.Status, result.Attempts, result.Error)
+	}
+	if len(prompts) != 2 || !strings.Contains(prompts[1], "could not be parsed") {
+		t.Fatalf("expected a repair prompt, got %d prompts", len(prompts))
+	}
+}
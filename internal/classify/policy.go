@@ -0,0 +1,96 @@
+package classify
+
+import "fmt"
+
+// SlicingPolicy decides how assignments become per-agent slices. All
+// fractions are of the document's total line count.
+type SlicingPolicy struct {
+	// MismatchFloor: unless some agent's measured lines exceed this fraction,
+	// the classification is treated as a domain mismatch.
+	MismatchFloor float64 `json:"mismatch_floor"`
+	// FullDocCeiling: an agent whose measured lines reach this fraction is
+	// sent the whole document instead of a slice.
+	FullDocCeiling float64 `json:"full_doc_ceiling"`
+	// MinPriorityConfidence demotes priority assignments below it to context.
+	MinPriorityConfidence float64 `json:"min_priority_confidence"`
+	// CountContext measures priority plus context lines against the floor and
+	// ceiling instead of priority lines alone.
+	CountContext bool `json:"count_context"`
+}
+
+// DefaultSlicingPolicy returns the flux-drive defaults: mismatch at or below
+// 10% priority lines, full document from 80%.
+func DefaultSlicingPolicy() SlicingPolicy {
+	return SlicingPolicy{MismatchFloor: 0.10, FullDocCeiling: 0.80}
+}
+
+// PolicyOverride changes selected SlicingPolicy fields; nil fields inherit.
+type PolicyOverride struct {
+	MismatchFloor         *float64 `json:"mismatch_floor,omitempty" yaml:"mismatch_floor"`
+	FullDocCeiling        *float64 `json:"full_doc_ceiling,omitempty" yaml:"full_doc_ceiling"`
+	MinPriorityConfidence *float64 `json:"min_priority_confidence,omitempty" yaml:"min_priority_confidence"`
+	CountContext          *bool    `json:"count_context,omitempty" yaml:"count_context"`
+}
+
+// Merge returns o with the fields set in next taking precedence.
+func (o PolicyOverride) Merge(next PolicyOverride) PolicyOverride {
+	if next.MismatchFloor != nil {
+		o.MismatchFloor = next.MismatchFloor
+	}
+	if next.FullDocCeiling != nil {
+		o.FullDocCeiling = next.FullDocCeiling
+	}
+	if next.MinPriorityConfidence != nil {
+		o.MinPriorityConfidence = next.MinPriorityConfidence
+	}
+	if next.CountContext != nil {
+		o.CountContext = next.CountContext
+	}
+	return o
+}
+
+// Validate checks that every set fraction is between 0 and 1.
+func (o PolicyOverride) Validate() error {
+	for _, f := range []struct {
+		name  string
+		value *float64
+	}{
+		{"mismatch_floor", o.MismatchFloor},
+		{"full_doc_ceiling", o.FullDocCeiling},
+		{"min_priority_confidence", o.MinPriorityConfidence},
+	} {
+		if f.value != nil && (*f.value < 0 || *f.value > 1) {
+			return fmt.Errorf("%s %g must be between 0 and 1", f.name, *f.value)
+		}
+	}
+	return nil
+}
+
+// Apply returns p with o's set fields applied.
+func (p SlicingPolicy) Apply(o *PolicyOverride) SlicingPolicy {
+	if o == nil {
+		return p
+	}
+	if o.MismatchFloor != nil {
+		p.MismatchFloor = *o.MismatchFloor
+	}
+	if o.FullDocCeiling != nil {
+		p.FullDocCeiling = *o.FullDocCeiling
+	}
+	if o.MinPriorityConfidence != nil {
+		p.MinPriorityConfidence = *o.MinPriorityConfidence
+	}
+	if o.CountContext != nil {
+		p.CountContext = *o.CountContext
+	}
+	return p
+}
+
+// measuredFraction is the share of totalLines the policy measures for slice.
+func (p SlicingPolicy) measuredFraction(slice AgentSlice, totalLines int) float64 {
+	lines := slice.TotalPriorityLines
+	if p.CountContext {
+		lines += slice.TotalContextLines
+	}
+	return float64(lines) / float64(totalLines)
+}
@@ -0,0 +1,158 @@
+package classify
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mistakeknot/interserve/internal/dispatch"
+	"github.com/mistakeknot/interserve/internal/extract"
+)
+
+func ptr[T any](v T) *T { return &v }
+
+func TestBuildResultUsesFloatFractions(t *testing.T) {
+	// 21 of 200 lines is 10.5%: integer division used to floor this to 10 and
+	// report a domain mismatch.
+	sections := []extract.Section{
+		{ID: 1, Heading: "A", LineCount: 21},
+		{ID: 2, Heading: "B", LineCount: 179},
+	}
+	classified := map[int][]SectionAssignment{1: {{Agent: "fd-safety", Relevance: "priority", Confidence: 0.9}}}
+
+	result := buildResult(classified, sections, DefaultAgents(), DefaultSlicingPolicy(), 0)
+	if result.Status != "success" {
+		t.Fatalf("10.5%% priority lines should clear a 10%% floor, got %q: %s", result.Status, result.Error)
+	}
+	if result.Policy == nil || *result.Policy != DefaultSlicingPolicy() {
+		t.Fatalf("expected the policy to be echoed, got %+v", result.Policy)
+	}
+}
+
+func TestBuildResultReportsConfiguredMismatchFloor(t *testing.T) {
+	sections := []extract.Section{
+		{ID: 1, Heading: "A", LineCount: 20},
+		{ID: 2, Heading: "B", LineCount: 80},
+	}
+	classified := map[int][]SectionAssignment{1: {{Agent: "fd-safety", Relevance: "priority", Confidence: 0.9}}}
+	policy := DefaultSlicingPolicy()
+	policy.MismatchFloor = 0.25
+
+	result := buildResult(classified, sections, DefaultAgents(), policy, 0)
+	if result.Status != "no_classification" || result.Error != "domain mismatch: no agent has >25% priority lines" {
+		t.Fatalf("expected mismatch at a 25%% floor, got %q: %s", result.Status, result.Error)
+	}
+}
+
+func TestBuildResultReportsPerAgentMismatchFloors(t *testing.T) {
+	sections := []extract.Section{
+		{ID: 1, Heading: "A", LineCount: 20},
+		{ID: 2, Heading: "B", LineCount: 80},
+	}
+	classified := map[int][]SectionAssignment{1: {{Agent: "fd-safety", Relevance: "priority", Confidence: 0.9}}}
+	agents := []AgentDomain{
+		{Name: "fd-safety", Slicing: &PolicyOverride{MismatchFloor: ptr(0.3)}},
+		{Name: "fd-correctness"},
+		{Name: "fd-quality", CrossCutting: true},
+	}
+
+	result := buildResult(classified, sections, agents, DefaultSlicingPolicy(), 0)
+	want := "domain mismatch: no agent has more priority lines than its mismatch floor (fd-safety >30%, fd-correctness >10%)"
+	if result.Status != "no_classification" || result.Error != want {
+		t.Fatalf("expected each agent's floor, got %q: %s", result.Status, result.Error)
+	}
+
+	agents[1].Slicing = &PolicyOverride{MismatchFloor: ptr(0.3)}
+	result = buildResult(classified, sections, agents, DefaultSlicingPolicy(), 0)
+	if result.Error != "domain mismatch: no agent has >30% priority lines" {
+		t.Fatalf("expected the overridden floor shared by every agent, got %s", result.Error)
+	}
+}
+
+func TestBuildResultCountContextReachesCeiling(t *testing.T) {
+	sections := []extract.Section{
+		{ID: 1, Heading: "A", LineCount: 50},
+		{ID: 2, Heading: "B", LineCount: 40},
+		{ID: 3, Heading: "C", LineCount: 10},
+	}
+	classified := map[int][]SectionAssignment{
+		1: {{Agent: "fd-safety", Relevance: "priority", Confidence: 0.9}},
+		2: {{Agent: "fd-safety", Relevance: "context", Confidence: 0.9}},
+	}
+
+	plain := buildResult(classified, sections, DefaultAgents(), DefaultSlicingPolicy(), 0)
+	if got := plain.SlicingMap["fd-safety"].PrioritySections; len(got) != 1 {
+		t.Fatalf("priority lines alone are 50%%; expected a slice, got %v", got)
+	}
+
+	policy := DefaultSlicingPolicy()
+	policy.CountContext = true
+	counted := buildResult(classified, sections, DefaultAgents(), policy, 0)
+	if got := counted.SlicingMap["fd-safety"].PrioritySections; len(got) != 3 {
+		t.Fatalf("priority plus context is 90%%; expected the full document, got %v", got)
+	}
+}
+
+func TestBuildResultDemotesLowConfidencePriority(t *testing.T) {
+	sections := []extract.Section{
+		{ID: 1, Heading: "A", LineCount: 50},
+		{ID: 2, Heading: "B", LineCount: 50},
+	}
+	classified := map[int][]SectionAssignment{
+		1: {{Agent: "fd-safety", Relevance: "priority", Confidence: 0.9}},
+		2: {{Agent: "fd-safety", Relevance: "priority", Confidence: 0.4}},
+	}
+	policy := DefaultSlicingPolicy()
+	policy.MinPriorityConfidence = 0.5
+
+	result := buildResult(classified, sections, DefaultAgents(), policy, 0)
+	slice := result.SlicingMap["fd-safety"]
+	if len(slice.PrioritySections) != 1 || len(slice.ContextSections) != 1 || slice.ContextSections[0] != 2 {
+		t.Fatalf("low-confidence priority should become context, got %+v", slice)
+	}
+	if result.Sections[1].Assignments[0].Relevance != "context" {
+		t.Fatalf("section assignment should show the demotion, got %+v", result.Sections[1].Assignments)
+	}
+}
+
+func TestClassifyLayersCallAndAgentPolicies(t *testing.T) {
+	sections := []extract.Section{
+		{ID: 1, Heading: "A", LineCount: 70},
+		{ID: 2, Heading: "B", LineCount: 30},
+	}
+	d := dispatch.Func(func(ctx context.Context, req dispatch.Request) (dispatch.Response, error) {
+		return dispatch.Response{Output: `{"sections":[{"section_id":1,"assignments":[
+			{"agent":"fd-safety","relevance":"priority","confidence":0.9},
+			{"agent":"fd-correctness","relevance":"priority","confidence":0.9}
+		]}]}`}, nil
+	})
+	agents := []AgentDomain{
+		{Name: "fd-safety"},
+		{Name: "fd-correctness", Slicing: &PolicyOverride{FullDocCeiling: ptr(0.9)}},
+	}
+	opts := Options{Slicing: PolicyOverride{FullDocCeiling: ptr(0.7)}}
+
+	result := Classify(context.Background(), d, sections, agents, opts)
+	if result.Status != "success" {
+		t.Fatalf("expected success, got %q: %s", result.Status, result.Error)
+	}
+	if result.Policy.FullDocCeiling != 0.7 || result.Policy.MismatchFloor != 0.1 {
+		t.Fatalf("call override should layer over the defaults, got %+v", result.Policy)
+	}
+	if got := result.SlicingMap["fd-safety"].PrioritySections; len(got) != 2 {
+		t.Fatalf("70%% meets the call's 0.7 ceiling; expected full document, got %v", got)
+	}
+	correctness := result.SlicingMap["fd-correctness"]
+	if len(correctness.PrioritySections) != 1 || correctness.Policy == nil || correctness.Policy.FullDocCeiling != 0.9 {
+		t.Fatalf("agent override should win and be echoed, got %+v", correctness)
+	}
+}
+
+func TestPolicyOverrideValidate(t *testing.T) {
+	if err := (PolicyOverride{MismatchFloor: ptr(1.5)}).Validate(); err == nil || !strings.Contains(err.Error(), "mismatch_floor") {
+		t.Fatalf("expected mismatch_floor range error, got %v", err)
+	}
+	if err := (PolicyOverride{FullDocCeiling: ptr(0.5)}).Validate(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
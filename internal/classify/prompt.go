@@ -10,26 +10,56 @@ import (
 
 // AgentDomain defines a domain specialist that can receive section assignments.
 type AgentDomain struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description" yaml:"description"`
+	// Keywords sharpen the local classifier; they are not sent to the model.
+	Keywords []string `json:"keywords,omitempty" yaml:"keywords"`
+	// CrossCutting agents may be assigned any section but are listed to the
+	// model as optional and are exempt from the domain mismatch guard and the
+	// full-document threshold.
+	CrossCutting bool `json:"cross_cutting,omitempty" yaml:"cross_cutting"`
+	// MinConfidence drops this agent's assignments below the given confidence.
+	MinConfidence float64 `json:"min_confidence,omitempty" yaml:"min_confidence"`
+	// Slicing refines the call's slicing policy for this agent.
+	Slicing *PolicyOverride `json:"slicing,omitempty" yaml:"slicing"`
+	// TokenBudget caps the estimated tokens of the agent's priority sections;
+	// zero defers to Options.TokenBudget.
+	TokenBudget int `json:"token_budget,omitempty" yaml:"token_budget"`
 }
 
 // DefaultAgents returns the baseline flux-drive domain agents.
 func DefaultAgents() []AgentDomain {
 	return []AgentDomain{
-		{Name: "fd-safety", Description: "Safety, trust, policy risk, abuse, and compliance impact."},
-		{Name: "fd-correctness", Description: "Functional correctness, invariants, and logic flaws."},
-		{Name: "fd-performance", Description: "Latency, throughput, scaling, and resource efficiency."},
-		{Name: "fd-user-product", Description: "User value, product behavior, and UX outcome quality."},
-		{Name: "fd-game-design", Description: "Systems balance, mechanics, progression, and play quality."},
+		{
+			Name:        "fd-safety",
+			Description: "Safety, trust, policy risk, abuse, and compliance impact.",
+			Keywords:    []string{"security", "auth", "authentication", "authorization", "permission", "secret", "credential", "token", "encryption", "privacy", "sandbox", "vulnerability", "injection", "audit", "threat", "attacker", "leak", "revoke"},
+		},
+		{
+			Name:        "fd-correctness",
+			Description: "Functional correctness, invariants, and logic flaws.",
+			Keywords:    []string{"bug", "edge case", "race", "concurrency", "concurrent", "atomic", "invariant", "ordering", "consistency", "validation", "error handling", "test", "transaction", "idempotent", "retry", "migration"},
+		},
+		{
+			Name:        "fd-performance",
+			Description: "Latency, throughput, scaling, and resource efficiency.",
+			Keywords:    []string{"cache", "caching", "memory", "cpu", "benchmark", "load", "queue", "batch", "index", "p99", "timeout", "concurrency"},
+		},
+		{
+			Name:        "fd-user-product",
+			Description: "User value, product behavior, and UX outcome quality.",
+			Keywords:    []string{"user", "customer", "onboarding", "workflow", "interface", "usability", "feedback", "feature", "accessibility", "experience"},
+		},
+		{
+			Name:        "fd-game-design",
+			Description: "Systems balance, mechanics, progression, and play quality.",
+			Keywords:    []string{"player", "game", "level", "reward", "loot", "difficulty", "combat", "economy", "quest", "gameplay"},
+		},
+		{Name: "fd-architecture", CrossCutting: true},
+		{Name: "fd-quality", CrossCutting: true},
 	}
 }
 
-var CrossCuttingAgents = map[string]bool{
-	"fd-architecture": true,
-	"fd-quality":      true,
-}
-
 // BuildPrompt builds a classification prompt for Codex spark dispatch.
 func BuildPrompt(sections []extract.Section, agents []AgentDomain) string {
 	if len(agents) == 0 {
@@ -41,21 +71,30 @@ func BuildPrompt(sections []extract.Section, agents []AgentDomain) string {
 	b.WriteString("Assign each section to zero or more agents with:\n")
 	b.WriteString("- relevance: priority | context\n")
 	b.WriteString("- confidence: 0.0 to 1.0\n")
+	b.WriteString("- rationale: one short sentence on why the section matters to the agent\n")
+	b.WriteString("- evidence: up to 3 lines quoted verbatim from the section\n")
 	b.WriteString("Only use the listed agent names.\n\n")
 
 	b.WriteString("Agent domains:\n")
+	var crossCutting []AgentDomain
 	for _, agent := range agents {
+		if agent.CrossCutting {
+			crossCutting = append(crossCutting, agent)
+			continue
+		}
 		fmt.Fprintf(&b, "- %s: %s\n", agent.Name, agent.Description)
 	}
 
-	keys := make([]string, 0, len(CrossCuttingAgents))
-	for name := range CrossCuttingAgents {
-		keys = append(keys, name)
-	}
-	sort.Strings(keys)
-	b.WriteString("\nCross-cutting agents (optional):\n")
-	for _, name := range keys {
-		fmt.Fprintf(&b, "- %s\n", name)
+	if len(crossCutting) > 0 {
+		sort.Slice(crossCutting, func(i, j int) bool { return crossCutting[i].Name < crossCutting[j].Name })
+		b.WriteString("\nCross-cutting agents (optional):\n")
+		for _, agent := range crossCutting {
+			if agent.Description == "" {
+				fmt.Fprintf(&b, "- %s\n", agent.Name)
+			} else {
+				fmt.Fprintf(&b, "- %s: %s\n", agent.Name, agent.Description)
+			}
+		}
 	}
 
 	b.WriteString("\nSections:\n")
@@ -75,6 +114,9 @@ func BuildPrompt(sections []extract.Section, agents []AgentDomain) string {
 
 		fmt.Fprintf(&b, "\nSection %d\n", section.ID)
 		fmt.Fprintf(&b, "Heading: %s\n", heading)
+		if section.Parent != 0 {
+			fmt.Fprintf(&b, "Subsection of: Section %d\n", section.Parent)
+		}
 		fmt.Fprintf(&b, "LineCount: %d\n", section.LineCount)
 		fmt.Fprintf(&b, "FirstSentence: %s\n", firstSentence)
 		b.WriteString("Preview:\n")
@@ -88,7 +130,8 @@ func BuildPrompt(sections []extract.Section, agents []AgentDomain) string {
 	b.WriteString("    {\n")
 	b.WriteString("      \"section_id\": 1,\n")
 	b.WriteString("      \"assignments\": [\n")
-	b.WriteString("        {\"agent\": \"fd-safety\", \"relevance\": \"priority\", \"confidence\": 0.95}\n")
+	b.WriteString("        {\"agent\": \"fd-safety\", \"relevance\": \"priority\", \"confidence\": 0.95,\n")
+	b.WriteString("         \"rationale\": \"Defines who may revoke credentials.\", \"evidence\": [\"Only admins can revoke API keys.\"]}\n")
 	b.WriteString("      ]\n")
 	b.WriteString("    }\n")
 	b.WriteString("  ]\n")
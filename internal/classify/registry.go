@@ -0,0 +1,121 @@
+package classify
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RegistryPath is where a project's agent registry lives, relative to any
+// directory at or above the document being classified.
+const RegistryPath = ".interserve/agents.yaml"
+
+type registryFile struct {
+	Agents []AgentDomain `yaml:"agents"`
+}
+
+// FindRegistry walks up from dir to the filesystem root and returns the first
+// RegistryPath found, or "" when there is none.
+func FindRegistry(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+	for {
+		candidate := filepath.Join(dir, RegistryPath)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// LoadRegistry reads the agents defined in a registry file. The file replaces
+// DefaultAgents entirely; an entry naming a built-in agent inherits its
+// description and keywords when it leaves them out.
+func LoadRegistry(path string) ([]AgentDomain, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file registryFile
+	dec := yaml.NewDecoder(bytes.NewReader(raw))
+	dec.KnownFields(true)
+	if err := dec.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if len(file.Agents) == 0 {
+		return nil, fmt.Errorf("%s defines no agents", path)
+	}
+
+	builtin := make(map[string]AgentDomain)
+	for _, agent := range DefaultAgents() {
+		builtin[agent.Name] = agent
+	}
+	for i, agent := range file.Agents {
+		if base, ok := builtin[agent.Name]; ok {
+			if agent.Description == "" {
+				file.Agents[i].Description = base.Description
+			}
+			if agent.Keywords == nil {
+				file.Agents[i].Keywords = base.Keywords
+			}
+		}
+	}
+	if err := ValidateAgents(file.Agents); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return file.Agents, nil
+}
+
+// AgentsForDocument returns the agents that apply to the document at docPath
+// and the registry file they came from, or DefaultAgents and "" when no
+// registry is found.
+func AgentsForDocument(docPath string) ([]AgentDomain, string, error) {
+	path := FindRegistry(filepath.Dir(docPath))
+	if path == "" {
+		return DefaultAgents(), "", nil
+	}
+	agents, err := LoadRegistry(path)
+	if err != nil {
+		return nil, path, err
+	}
+	return agents, path, nil
+}
+
+// ValidateAgents checks that agents have unique names and thresholds and
+// budgets in range.
+func ValidateAgents(agents []AgentDomain) error {
+	seen := make(map[string]bool, len(agents))
+	for i, agent := range agents {
+		if agent.Name == "" {
+			return fmt.Errorf("agent %d has no name", i+1)
+		}
+		if seen[agent.Name] {
+			return fmt.Errorf("agent %q is defined twice", agent.Name)
+		}
+		seen[agent.Name] = true
+		if agent.Slicing != nil {
+			if err := agent.Slicing.Validate(); err != nil {
+				return fmt.Errorf("agent %q: slicing: %w", agent.Name, err)
+			}
+		}
+		if agent.MinConfidence < 0 || agent.MinConfidence > 1 {
+			return fmt.Errorf("agent %q: min_confidence %g must be between 0 and 1", agent.Name, agent.MinConfidence)
+		}
+		if agent.TokenBudget < 0 {
+			return fmt.Errorf("agent %q: token_budget %d must not be negative", agent.Name, agent.TokenBudget)
+		}
+	}
+	return nil
+}
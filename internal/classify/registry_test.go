@@ -0,0 +1,90 @@
+package classify
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeRegistry(t *testing.T, dir, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, RegistryPath)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestAgentsForDocumentDiscoversRegistryUpward(t *testing.T) {
+	root := t.TempDir()
+	path := writeRegistry(t, root, `
+agents:
+  - name: fd-safety
+  - name: fd-data
+    description: Storage layout and migrations.
+    keywords: [shard, schema]
+    slicing:
+      full_doc_ceiling: 0.6
+    min_confidence: 0.4
+  - name: fd-architecture
+    cross_cutting: true
+`)
+	docDir := filepath.Join(root, "docs", "plans")
+	if err := os.MkdirAll(docDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	agents, found, err := AgentsForDocument(filepath.Join(docDir, "plan.md"))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if found != path {
+		t.Fatalf("found registry %q, want %q", found, path)
+	}
+	if len(agents) != 3 {
+		t.Fatalf("registry should replace the defaults, got %+v", agents)
+	}
+	if !strings.HasPrefix(agents[0].Description, "Safety, trust") || len(agents[0].Keywords) == 0 {
+		t.Fatalf("built-in agent should inherit description and keywords, got %+v", agents[0])
+	}
+	data := agents[1]
+	if data.Name != "fd-data" || data.Slicing == nil || *data.Slicing.FullDocCeiling != 0.6 || data.MinConfidence != 0.4 || len(data.Keywords) != 2 {
+		t.Fatalf("unexpected custom agent %+v", data)
+	}
+	if !agents[2].CrossCutting {
+		t.Fatalf("expected cross-cutting flag, got %+v", agents[2])
+	}
+}
+
+func TestAgentsForDocumentDefaultsWithoutRegistry(t *testing.T) {
+	agents, found, err := AgentsForDocument(filepath.Join(t.TempDir(), "plan.md"))
+	if err != nil || found != "" {
+		t.Fatalf("expected no registry, got %q, %v", found, err)
+	}
+	if len(agents) != len(DefaultAgents()) {
+		t.Fatalf("expected default agents, got %d", len(agents))
+	}
+}
+
+func TestLoadRegistryRejectsInvalidFiles(t *testing.T) {
+	tests := map[string]string{
+		"unknown field":   "agents:\n  - name: fd-safety\n    weight: 2\n",
+		"duplicate name":  "agents:\n  - name: fd-safety\n  - name: fd-safety\n",
+		"bad threshold":   "agents:\n  - name: fd-safety\n    slicing:\n      full_doc_ceiling: 80\n",
+		"no agents":       "agents: []\n",
+		"negative budget": "agents:\n  - name: fd-safety\n    token_budget: -1\n",
+		"missing name":    "agents:\n  - description: nameless\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := writeRegistry(t, t.TempDir(), content)
+			if _, err := LoadRegistry(path); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package classify
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/mistakeknot/interserve/internal/dispatch"
+	"github.com/mistakeknot/interserve/internal/extract"
+)
+
+// TestClassifyReplayPlan runs the full classify pipeline offline against a
+// recorded dispatch. If the prompt changes, the fixture key changes and this
+// test fails until the fixture is re-recorded with INTERSERVE_RECORD_DIR.
+func TestClassifyReplayPlan(t *testing.T) {
+	doc, err := os.ReadFile("testdata/plan.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sections := extract.ExtractSections(string(doc))
+
+	result := Classify(context.Background(), dispatch.NewReplayer("testdata/replay"), sections, DefaultAgents(), DefaultOptions())
+	if result.Status != "success" {
+		t.Fatalf("replay failed (%q): %s", result.Status, result.Error)
+	}
+	if result.Backend != "replay" {
+		t.Fatalf("expected replay backend to be reported, got %q", result.Backend)
+	}
+	if result.Escalated {
+		t.Fatalf("recorded classification should not escalate: %s", result.EscalationReason)
+	}
+
+	want := map[string][]int{
+		"fd-safety":       {2},
+		"fd-correctness":  {3},
+		"fd-performance":  {4},
+		"fd-user-product": {5},
+	}
+	for agent, priority := range want {
+		if got := result.SlicingMap[agent].PrioritySections; !reflect.DeepEqual(got, priority) {
+			t.Errorf("%s priority sections = %v, want %v", agent, got, priority)
+		}
+	}
+	if got := result.SlicingMap["fd-safety"].ContextSections; !reflect.DeepEqual(got, []int{3}) {
+		t.Errorf("fd-safety context sections = %v, want [3]", got)
+	}
+
+	safety := result.Sections[1].Assignments[0]
+	if safety.Agent != "fd-safety" || safety.Rationale == "" || len(safety.Evidence) != 2 {
+		t.Errorf("expected fd-safety rationale and two evidence lines on section 2, got %+v", safety)
+	}
+	if len(result.Warnings) != 0 {
+		t.Errorf("recorded evidence should all be quoted from the plan, got warnings %q", result.Warnings)
+	}
+}
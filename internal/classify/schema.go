@@ -0,0 +1,178 @@
+package classify
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/mistakeknot/interserve/internal/extract"
+)
+
+// dispatchAssignment is an assignment as the model emitted it. Confidence is
+// kept raw so a quoted or malformed value is reported rather than failing the
+// whole decode.
+type dispatchAssignment struct {
+	Agent      string          `json:"agent"`
+	Relevance  string          `json:"relevance"`
+	Confidence json.RawMessage `json:"confidence"`
+	Rationale  string          `json:"rationale"`
+	Evidence   []string        `json:"evidence"`
+}
+
+// ResponseSchema returns the JSON Schema a classification response must
+// satisfy for these sections and agents. Backends with structured output
+// enforce it; every decoded response is checked against the same rules by
+// validateResponse.
+func ResponseSchema(sections []extract.Section, agents []AgentDomain) json.RawMessage {
+	sectionIDs := make([]int, 0, len(sections))
+	for _, section := range sections {
+		sectionIDs = append(sectionIDs, section.ID)
+	}
+
+	assignment := map[string]any{
+		"type":                 "object",
+		"additionalProperties": false,
+		"required":             []string{"agent", "relevance", "confidence", "rationale", "evidence"},
+		"properties": map[string]any{
+			"agent":      map[string]any{"type": "string", "enum": schemaAgentNames(agents)},
+			"relevance":  map[string]any{"type": "string", "enum": []string{"priority", "context"}},
+			"confidence": map[string]any{"type": "number", "minimum": 0, "maximum": 1},
+			"rationale":  map[string]any{"type": "string"},
+			"evidence":   map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		},
+	}
+	section := map[string]any{
+		"type":                 "object",
+		"additionalProperties": false,
+		"required":             []string{"section_id", "assignments"},
+		"properties": map[string]any{
+			"section_id":  map[string]any{"type": "integer", "enum": sectionIDs},
+			"assignments": map[string]any{"type": "array", "items": assignment},
+		},
+	}
+	schema := map[string]any{
+		"type":                 "object",
+		"additionalProperties": false,
+		"required":             []string{"sections"},
+		"properties": map[string]any{
+			"sections": map[string]any{"type": "array", "items": section},
+		},
+	}
+
+	raw, err := json.Marshal(schema)
+	if err != nil {
+		// Only plain maps, strings and ints above; this cannot fail.
+		panic(fmt.Sprintf("marshal classification schema: %v", err))
+	}
+	return raw
+}
+
+// schemaAgentNames lists the agent names in order, without duplicates.
+func schemaAgentNames(agents []AgentDomain) []string {
+	names := make([]string, 0, len(agents))
+	seen := make(map[string]bool, len(agents))
+	for _, agent := range agents {
+		if !seen[agent.Name] {
+			names = append(names, agent.Name)
+			seen[agent.Name] = true
+		}
+	}
+	return names
+}
+
+// validateResponse applies the response schema to decoded and returns the
+// usable assignments by section ID. Every assignment that had to be dropped or
+// coerced produces a warning, and every drop a normalization decision.
+// Evidence not quoted from its section is dropped with a warning; a missing
+// rationale or evidence is accepted.
+func validateResponse(decoded dispatchResponse, sections []extract.Section, agents []AgentDomain) (map[int][]SectionAssignment, []string, []Decision) {
+	byID := make(map[int]extract.Section, len(sections))
+	for _, section := range sections {
+		byID[section.ID] = section
+	}
+	allowed := allowedAgents(agents)
+
+	classified := make(map[int][]SectionAssignment, len(decoded.Sections))
+	var warnings []string
+	var decisions []Decision
+	for _, section := range decoded.Sections {
+		source, ok := byID[section.SectionID]
+		if !ok {
+			detail := fmt.Sprintf("not in document; %d assignment(s) dropped", len(section.Assignments))
+			warnings = append(warnings, fmt.Sprintf("section %d: %s", section.SectionID, detail))
+			decisions = append(decisions, Decision{Rule: ruleNormalization, SectionID: section.SectionID, Detail: detail})
+			continue
+		}
+		for _, raw := range section.Assignments {
+			a, warning, ok := validateAssignment(raw, allowed)
+			if warning != "" {
+				warnings = append(warnings, fmt.Sprintf("section %d: %s", section.SectionID, warning))
+			}
+			if !ok {
+				decisions = append(decisions, Decision{Rule: ruleNormalization, SectionID: section.SectionID, Agent: a.Agent, Detail: warning})
+				continue
+			}
+			var dropped []string
+			a.Evidence, dropped = checkEvidence(raw.Evidence, source)
+			for _, w := range dropped {
+				warnings = append(warnings, fmt.Sprintf("section %d: %s: %s", section.SectionID, a.Agent, w))
+			}
+			classified[section.SectionID] = append(classified[section.SectionID], a)
+		}
+	}
+	return classified, warnings, decisions
+}
+
+// validateAssignment normalizes one assignment. ok is false when it must be
+// dropped; warning explains any drop or coercion.
+func validateAssignment(raw dispatchAssignment, allowed map[string]bool) (SectionAssignment, string, bool) {
+	a := SectionAssignment{
+		Agent:     strings.TrimSpace(raw.Agent),
+		Relevance: strings.TrimSpace(strings.ToLower(raw.Relevance)),
+		Rationale: strings.TrimSpace(raw.Rationale),
+	}
+	if !allowed[a.Agent] {
+		return a, fmt.Sprintf("unknown agent %q dropped", raw.Agent), false
+	}
+	if a.Relevance != "priority" && a.Relevance != "context" {
+		return a, fmt.Sprintf("%s: relevance %q is not priority or context; assignment dropped", a.Agent, raw.Relevance), false
+	}
+
+	confidence, err := decodeConfidence(raw.Confidence)
+	if err != nil {
+		return a, fmt.Sprintf("%s: %v; assignment dropped", a.Agent, err), false
+	}
+	a.Confidence = confidence
+
+	var warning string
+	switch {
+	case confidence < 0:
+		a.Confidence = 0
+		warning = fmt.Sprintf("%s: confidence %g clamped to 0", a.Agent, confidence)
+	case confidence > 1:
+		a.Confidence = 1
+		warning = fmt.Sprintf("%s: confidence %g clamped to 1", a.Agent, confidence)
+	case len(raw.Confidence) > 0 && raw.Confidence[0] == '"':
+		warning = fmt.Sprintf("%s: confidence %s is a string; read as %g", a.Agent, raw.Confidence, confidence)
+	}
+	return a, warning, true
+}
+
+// decodeConfidence accepts a JSON number, or a string holding one.
+func decodeConfidence(raw json.RawMessage) (float64, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return 0, fmt.Errorf("confidence is missing")
+	}
+	var n float64
+	if err := json.Unmarshal(raw, &n); err == nil {
+		return n, nil
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		if n, err := strconv.ParseFloat(strings.TrimSpace(s), 64); err == nil {
+			return n, nil
+		}
+	}
+	return 0, fmt.Errorf("confidence %s is not a number", raw)
+}
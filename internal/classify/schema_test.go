@@ -0,0 +1,130 @@
+package classify
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/mistakeknot/interserve/internal/dispatch"
+	"github.com/mistakeknot/interserve/internal/extract"
+)
+
+func TestResponseSchemaEnumeratesAgentsAndSections(t *testing.T) {
+	sections := []extract.Section{{ID: 1, Heading: "A"}, {ID: 3, Heading: "B"}}
+	agents := []AgentDomain{{Name: "fd-safety"}, {Name: "fd-correctness"}, {Name: "fd-quality", CrossCutting: true}}
+
+	var schema struct {
+		Properties struct {
+			Sections struct {
+				Items struct {
+					Properties struct {
+						SectionID struct {
+							Enum []int `json:"enum"`
+						} `json:"section_id"`
+						Assignments struct {
+							Items struct {
+								Properties struct {
+									Agent struct {
+										Enum []string `json:"enum"`
+									} `json:"agent"`
+								} `json:"properties"`
+							} `json:"items"`
+						} `json:"assignments"`
+					} `json:"properties"`
+				} `json:"items"`
+			} `json:"sections"`
+		} `json:"properties"`
+	}
+	if err := json.Unmarshal(ResponseSchema(sections, agents), &schema); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+
+	item := schema.Properties.Sections.Items.Properties
+	if !slices.Equal(item.SectionID.Enum, []int{1, 3}) {
+		t.Fatalf("unexpected section_id enum %v", item.SectionID.Enum)
+	}
+	wantAgents := []string{"fd-safety", "fd-correctness", "fd-quality"}
+	if got := item.Assignments.Items.Properties.Agent.Enum; !slices.Equal(got, wantAgents) {
+		t.Fatalf("agent enum = %v, want %v", got, wantAgents)
+	}
+}
+
+func TestValidateResponseWarnsOnViolations(t *testing.T) {
+	sections := []extract.Section{{ID: 1, Heading: "A"}, {ID: 2, Heading: "B"}}
+	decoded, err := parseDispatchResponse(`{"sections":[
+		{"section_id":1,"assignments":[
+			{"agent":"fd-safety","relevance":"priority","confidence":0.9},
+			{"agent":"fd-unknown","relevance":"priority","confidence":0.9},
+			{"agent":"fd-performance","relevance":"high","confidence":0.9},
+			{"agent":"fd-correctness","relevance":"context","confidence":"very"}
+		]},
+		{"section_id":2,"assignments":[
+			{"agent":"fd-safety","relevance":"context","confidence":"0.4"},
+			{"agent":"fd-correctness","relevance":"priority","confidence":1.5}
+		]},
+		{"section_id":9,"assignments":[{"agent":"fd-safety","relevance":"priority","confidence":0.9}]}
+	]}`)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	classified, warnings, _ := validateResponse(decoded, sections, DefaultAgents())
+
+	want := map[int][]SectionAssignment{
+		1: {{Agent: "fd-safety", Relevance: "priority", Confidence: 0.9}},
+		2: {
+			{Agent: "fd-safety", Relevance: "context", Confidence: 0.4},
+			{Agent: "fd-correctness", Relevance: "priority", Confidence: 1},
+		},
+	}
+	for id, assignments := range want {
+		if !reflect.DeepEqual(classified[id], assignments) {
+			t.Fatalf("section %d: got %+v, want %+v", id, classified[id], assignments)
+		}
+	}
+	if _, ok := classified[9]; ok {
+		t.Fatal("section outside the document should be dropped")
+	}
+
+	for _, fragment := range []string{
+		`section 1: unknown agent "fd-unknown" dropped`,
+		`section 1: fd-performance: relevance "high" is not priority or context`,
+		`section 1: fd-correctness: confidence "very" is not a number`,
+		`section 2: fd-safety: confidence "0.4" is a string; read as 0.4`,
+		`section 2: fd-correctness: confidence 1.5 clamped to 1`,
+		`section 9: not in document; 1 assignment(s) dropped`,
+	} {
+		if !slices.ContainsFunc(warnings, func(w string) bool { return strings.Contains(w, fragment) }) {
+			t.Errorf("missing warning %q in %q", fragment, warnings)
+		}
+	}
+	if len(warnings) != 6 {
+		t.Fatalf("expected 6 warnings, got %d: %q", len(warnings), warnings)
+	}
+}
+
+func TestClassifySendsSchemaAndReportsWarnings(t *testing.T) {
+	sections := []extract.Section{{ID: 1, Heading: "Auth", LineCount: 10}}
+	var schemas []json.RawMessage
+	d := dispatch.Func(func(ctx context.Context, req dispatch.Request) (dispatch.Response, error) {
+		schemas = append(schemas, req.Schema)
+		return dispatch.Response{Output: `{"sections":[{"section_id":1,"assignments":[
+			{"agent":"fd-safety","relevance":"priority","confidence":0.9},
+			{"agent":"fd-made-up","relevance":"priority","confidence":0.9}
+		]}]}`}, nil
+	})
+
+	result := Classify(context.Background(), d, sections, DefaultAgents(), DefaultOptions())
+	if result.Status != "success" {
+		t.Fatalf("expected success, got %q: %s", result.Status, result.Error)
+	}
+	if len(schemas) != 1 || !json.Valid(schemas[0]) {
+		t.Fatalf("expected one dispatch carrying a JSON schema, got %q", schemas)
+	}
+	if len(result.Warnings) != 1 || !strings.Contains(result.Warnings[0], "fd-made-up") {
+		t.Fatalf("expected unknown agent warning, got %q", result.Warnings)
+	}
+}
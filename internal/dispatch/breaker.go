@@ -0,0 +1,190 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 30 * time.Second
+
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// ErrBackendUnavailable is returned while the circuit breaker is open.
+var ErrBackendUnavailable = errors.New("backend unavailable")
+
+// BreakerOpenError reports a short-circuited dispatch and when to retry.
+type BreakerOpenError struct {
+	RetryAfter time.Duration
+	LastError  string
+}
+
+func (e *BreakerOpenError) Error() string {
+	msg := fmt.Sprintf("%v: circuit open, retry after %s", ErrBackendUnavailable, e.RetryAfter.Round(time.Second))
+	if e.LastError != "" {
+		msg += " (last error: " + e.LastError + ")"
+	}
+	return msg
+}
+
+func (e *BreakerOpenError) Unwrap() error {
+	return ErrBackendUnavailable
+}
+
+// BreakerState is a point-in-time view of a Breaker for diagnostics.
+type BreakerState struct {
+	State               string `json:"state"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	Threshold           int    `json:"threshold"`
+	CooldownMs          int64  `json:"cooldown_ms"`
+	// OpenedAt is when the circuit last opened; nil if it never has.
+	OpenedAt     *time.Time `json:"opened_at,omitempty"`
+	RetryAfterMs int64      `json:"retry_after_ms,omitempty"`
+	TimesOpened  int        `json:"times_opened"`
+	LastError    string     `json:"last_error,omitempty"`
+}
+
+// Breaker short-circuits dispatches after Threshold consecutive failures.
+// After Cooldown it lets a single probe through (half-open); the probe's
+// outcome closes or re-opens the circuit.
+type Breaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu          sync.Mutex
+	state       string
+	failures    int
+	openedAt    time.Time
+	probing     bool
+	timesOpened int
+	lastError   string
+}
+
+// NewBreaker returns a closed Breaker; non-positive values select the defaults.
+func NewBreaker(threshold int, cooldown time.Duration) *Breaker {
+	if threshold <= 0 {
+		threshold = DefaultBreakerThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = DefaultBreakerCooldown
+	}
+	return &Breaker{threshold: threshold, cooldown: cooldown, now: time.Now, state: BreakerClosed}
+}
+
+// Middleware returns a Middleware guarding next with b.
+func (b *Breaker) Middleware() Middleware {
+	return func(next Dispatcher) Dispatcher {
+		return Func(func(ctx context.Context, req Request) (Response, error) {
+			if err := b.allow(); err != nil {
+				return Response{}, err
+			}
+			resp, err := next.Dispatch(ctx, req)
+			b.record(err)
+			return resp, err
+		})
+	}
+}
+
+// State reports the breaker's current state.
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := BreakerState{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		Threshold:           b.threshold,
+		CooldownMs:          b.cooldown.Milliseconds(),
+		TimesOpened:         b.timesOpened,
+		LastError:           b.lastError,
+	}
+	if !b.openedAt.IsZero() {
+		openedAt := b.openedAt
+		state.OpenedAt = &openedAt
+	}
+	if b.state == BreakerOpen {
+		// The next dispatch probes once the cooldown has passed; until one does,
+		// the state stays open with nothing left to wait for.
+		state.RetryAfterMs = max(0, b.retryAfter()).Milliseconds()
+	}
+	return state
+}
+
+func (b *Breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if wait := b.retryAfter(); wait > 0 {
+			return &BreakerOpenError{RetryAfter: wait, LastError: b.lastError}
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return nil
+	case BreakerHalfOpen:
+		if b.probing {
+			// One probe at a time; everyone else waits for its verdict.
+			return &BreakerOpenError{RetryAfter: time.Second, LastError: b.lastError}
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+func (b *Breaker) record(err error) {
+	if !countsAsBackendFailure(err) {
+		// Caller cancellations and local overload say nothing about backend health,
+		// but a probe that ended that way must not wedge the breaker half-open.
+		b.mu.Lock()
+		b.probing = false
+		b.mu.Unlock()
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if err == nil {
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	b.lastError = err.Error()
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		if b.state != BreakerOpen {
+			b.timesOpened++
+		}
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+func (b *Breaker) retryAfter() time.Duration {
+	return b.cooldown - b.now().Sub(b.openedAt)
+}
+
+func countsAsBackendFailure(err error) bool {
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, ErrOverloaded)
+}
+
+// RetryAfter returns the retry hint carried by a short-circuited dispatch
+// error, or 0 when err did not come from an open breaker.
+func RetryAfter(err error) time.Duration {
+	var open *BreakerOpenError
+	if errors.As(err, &open) {
+		return open.RetryAfter
+	}
+	return 0
+}
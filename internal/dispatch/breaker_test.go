@@ -0,0 +1,177 @@
+package dispatch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func newTestBreaker(threshold int, cooldown time.Duration) (*Breaker, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(1_700_000_000, 0)}
+	b := NewBreaker(threshold, cooldown)
+	b.now = clock.now
+	return b, clock
+}
+
+func TestBreakerOpensAfterConsecutiveFailures(t *testing.T) {
+	b, _ := newTestBreaker(3, time.Minute)
+	calls := 0
+	d := Chain(Func(func(ctx context.Context, req Request) (Response, error) {
+		calls++
+		return Response{}, errors.New("dispatch.sh: exit status 1")
+	}), b.Middleware())
+
+	for i := 0; i < 3; i++ {
+		if _, err := d.Dispatch(context.Background(), Request{}); errors.Is(err, ErrBackendUnavailable) {
+			t.Fatalf("call %d short-circuited before threshold", i+1)
+		}
+	}
+	_, err := d.Dispatch(context.Background(), Request{})
+	if !errors.Is(err, ErrBackendUnavailable) {
+		t.Fatalf("expected ErrBackendUnavailable, got %v", err)
+	}
+	if calls != 3 {
+		t.Fatalf("open breaker should not reach the backend, got %d calls", calls)
+	}
+	if got := RetryAfter(err); got != time.Minute {
+		t.Fatalf("expected full cooldown as retry hint, got %s", got)
+	}
+	state := b.State()
+	if state.State != BreakerOpen || state.TimesOpened != 1 || state.LastError != "dispatch.sh: exit status 1" {
+		t.Fatalf("unexpected state %+v", state)
+	}
+	if state.OpenedAt == nil || !state.OpenedAt.Equal(time.Unix(1_700_000_000, 0)) {
+		t.Fatalf("expected opened_at to be the clock time, got %v", state.OpenedAt)
+	}
+}
+
+func TestBreakerStateOmitsOpenedAtUntilOpened(t *testing.T) {
+	raw, err := json.Marshal(NewBreaker(0, 0).State())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "opened_at") {
+		t.Fatalf("closed breaker should not report opened_at: %s", raw)
+	}
+}
+
+func TestBreakerStateRetryAfterNeverNegative(t *testing.T) {
+	b, clock := newTestBreaker(1, time.Minute)
+	d := Chain(Func(func(ctx context.Context, req Request) (Response, error) {
+		return Response{}, errors.New("boom")
+	}), b.Middleware())
+
+	_, _ = d.Dispatch(context.Background(), Request{})
+	clock.t = clock.t.Add(5 * time.Minute)
+	if state := b.State(); state.State != BreakerOpen || state.RetryAfterMs != 0 {
+		t.Fatalf("elapsed cooldown should report retry_after_ms 0 until probed: %+v", state)
+	}
+}
+
+func TestBreakerSuccessResetsFailureCount(t *testing.T) {
+	b, _ := newTestBreaker(2, time.Minute)
+	fail := true
+	d := Chain(Func(func(ctx context.Context, req Request) (Response, error) {
+		if fail {
+			return Response{}, errors.New("boom")
+		}
+		return Response{Output: "ok"}, nil
+	}), b.Middleware())
+
+	_, _ = d.Dispatch(context.Background(), Request{})
+	fail = false
+	_, _ = d.Dispatch(context.Background(), Request{})
+	fail = true
+	_, _ = d.Dispatch(context.Background(), Request{})
+	if state := b.State(); state.State != BreakerClosed || state.ConsecutiveFailures != 1 {
+		t.Fatalf("non-consecutive failures should not open the breaker: %+v", state)
+	}
+}
+
+func TestBreakerHalfOpenProbe(t *testing.T) {
+	b, clock := newTestBreaker(1, time.Minute)
+	fail := true
+	d := Chain(Func(func(ctx context.Context, req Request) (Response, error) {
+		if fail {
+			return Response{}, errors.New("boom")
+		}
+		return Response{Output: "ok"}, nil
+	}), b.Middleware())
+
+	_, _ = d.Dispatch(context.Background(), Request{})
+	clock.t = clock.t.Add(20 * time.Second)
+	if _, err := d.Dispatch(context.Background(), Request{}); RetryAfter(err) != 40*time.Second {
+		t.Fatalf("expected 40s retry hint, got %v", err)
+	}
+
+	// A failed probe re-opens for a full cooldown.
+	clock.t = clock.t.Add(40 * time.Second)
+	if _, err := d.Dispatch(context.Background(), Request{}); err == nil || errors.Is(err, ErrBackendUnavailable) {
+		t.Fatalf("expected the probe to reach the backend, got %v", err)
+	}
+	if state := b.State(); state.State != BreakerOpen || state.RetryAfterMs != time.Minute.Milliseconds() || state.TimesOpened != 2 {
+		t.Fatalf("failed probe should re-open the breaker: %+v", state)
+	}
+
+	// A successful probe closes it.
+	clock.t = clock.t.Add(time.Minute)
+	fail = false
+	if _, err := d.Dispatch(context.Background(), Request{}); err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if state := b.State(); state.State != BreakerClosed || state.ConsecutiveFailures != 0 {
+		t.Fatalf("successful probe should close the breaker: %+v", state)
+	}
+}
+
+func TestBreakerAllowsOneProbeAtATime(t *testing.T) {
+	b, clock := newTestBreaker(1, time.Minute)
+	g := newGate()
+	failing := Func(func(ctx context.Context, req Request) (Response, error) {
+		return Response{}, errors.New("boom")
+	})
+	_, _ = Chain(failing, b.Middleware()).Dispatch(context.Background(), Request{})
+
+	clock.t = clock.t.Add(time.Minute)
+	d := Chain(g, b.Middleware())
+	done := make(chan error, 1)
+	go func() {
+		_, err := d.Dispatch(context.Background(), Request{})
+		done <- err
+	}()
+	<-g.entered
+
+	if _, err := d.Dispatch(context.Background(), Request{}); !errors.Is(err, ErrBackendUnavailable) {
+		t.Fatalf("second caller during probe should be short-circuited, got %v", err)
+	}
+	close(g.release)
+	if err := <-done; err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if state := b.State(); state.State != BreakerClosed {
+		t.Fatalf("expected closed after probe, got %+v", state)
+	}
+}
+
+func TestBreakerIgnoresCallerCancellationAndOverload(t *testing.T) {
+	b, _ := newTestBreaker(1, time.Minute)
+	errs := []error{context.Canceled, ErrOverloaded}
+	d := Chain(Func(func(ctx context.Context, req Request) (Response, error) {
+		err := errs[0]
+		errs = errs[1:]
+		return Response{}, err
+	}), b.Middleware())
+
+	_, _ = d.Dispatch(context.Background(), Request{})
+	_, _ = d.Dispatch(context.Background(), Request{})
+	if state := b.State(); state.State != BreakerClosed || state.ConsecutiveFailures != 0 {
+		t.Fatalf("cancellation and overload should not count as backend failures: %+v", state)
+	}
+}
@@ -0,0 +1,73 @@
+package dispatch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	TierFast = "fast"
+	TierDeep = "deep"
+)
+
+// Request is a single prompt sent to a model backend.
+type Request struct {
+	Prompt string
+	Tier   string
+	// Tool names the MCP tool issuing the request, for queue fairness.
+	Tool string
+	// Schema, when set, is a JSON Schema the output must satisfy. Backends
+	// with structured output enforce it; the rest ignore it.
+	Schema json.RawMessage
+}
+
+// Response is the raw model output plus dispatch metadata.
+type Response struct {
+	Output    string
+	Backend   string
+	Duration  time.Duration
+	QueueWait time.Duration
+	Usage     Usage
+}
+
+// Dispatcher sends a prompt to a model backend and returns its raw output.
+// Implementations must be safe for concurrent use.
+type Dispatcher interface {
+	Dispatch(ctx context.Context, req Request) (Response, error)
+}
+
+// Func adapts a plain function to the Dispatcher interface.
+type Func func(ctx context.Context, req Request) (Response, error)
+
+// Dispatch calls f(ctx, req).
+func (f Func) Dispatch(ctx context.Context, req Request) (Response, error) {
+	return f(ctx, req)
+}
+
+// Middleware wraps a Dispatcher with cross-cutting behavior.
+type Middleware func(Dispatcher) Dispatcher
+
+// Chain wraps d with the given middleware. The first middleware is outermost.
+func Chain(d Dispatcher, middleware ...Middleware) Dispatcher {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		d = middleware[i](d)
+	}
+	return d
+}
+
+// ErrorStatus maps a dispatch error onto the status tools report for it:
+// "overloaded", "backend_unavailable" or "timeout", or otherwise for any
+// other failure.
+func ErrorStatus(err error, otherwise string) string {
+	switch {
+	case errors.Is(err, ErrOverloaded):
+		return "overloaded"
+	case errors.Is(err, ErrBackendUnavailable):
+		return "backend_unavailable"
+	case errors.Is(err, ErrTimeout), errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	}
+	return otherwise
+}
@@ -0,0 +1,87 @@
+package dispatch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShellDispatchReadsOutputFile(t *testing.T) {
+	script := writeScript(t, `
+while [[ $# -gt 0 ]]; do
+  case "$1" in
+    --tier) tier="$2"; shift 2 ;;
+    --prompt-file) prompt="$2"; shift 2 ;;
+    -o) out="$2"; shift 2 ;;
+    *) shift ;;
+  esac
+done
+printf '%s:%s' "$tier" "$(cat "$prompt")" > "$out"
+`)
+
+	resp, err := NewShell(script).Dispatch(context.Background(), Request{Prompt: "hello", Tier: TierDeep})
+	if err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	if resp.Output != "deep:hello" {
+		t.Fatalf("unexpected output %q", resp.Output)
+	}
+	if resp.Backend != "shell" {
+		t.Fatalf("unexpected backend %q", resp.Backend)
+	}
+}
+
+func TestShellDispatchFallsBackToCombinedOutput(t *testing.T) {
+	script := writeScript(t, `echo "printed to stdout"`)
+
+	resp, err := NewShell(script).Dispatch(context.Background(), Request{Prompt: "hello"})
+	if err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	if resp.Output != "printed to stdout" {
+		t.Fatalf("unexpected output %q", resp.Output)
+	}
+}
+
+func TestShellDispatchReportsFailureOutput(t *testing.T) {
+	script := writeScript(t, `echo "codex exploded" >&2; exit 3`)
+
+	_, err := NewShell(script).Dispatch(context.Background(), Request{Prompt: "hello"})
+	if err == nil || !strings.Contains(err.Error(), "codex exploded") {
+		t.Fatalf("expected failure output in error, got %v", err)
+	}
+}
+
+func TestChainOrdersMiddlewareOutermostFirst(t *testing.T) {
+	var order []string
+	tag := func(name string) Middleware {
+		return func(next Dispatcher) Dispatcher {
+			return Func(func(ctx context.Context, req Request) (Response, error) {
+				order = append(order, name)
+				return next.Dispatch(ctx, req)
+			})
+		}
+	}
+	base := Func(func(ctx context.Context, req Request) (Response, error) {
+		order = append(order, "base")
+		return Response{Output: req.Prompt}, nil
+	})
+
+	if _, err := Chain(base, tag("a"), tag("b")).Dispatch(context.Background(), Request{Prompt: "x"}); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	if got := strings.Join(order, ","); got != "a,b,base" {
+		t.Fatalf("unexpected middleware order %q", got)
+	}
+}
+
+func writeScript(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "dispatch.sh")
+	if err := os.WriteFile(path, []byte("#!/usr/bin/env bash\n"+body), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
@@ -0,0 +1,165 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// latencyWindow is how many recent successful latencies each backend keeps.
+	latencyWindow = 64
+	// minHedgeSamples is how many latencies a backend needs before it is hedged.
+	minHedgeSamples = 8
+)
+
+// Backend names a Dispatcher within a Fallback chain.
+type Backend struct {
+	Name string
+	Dispatcher
+}
+
+// Fallback tries backends in order, falling through to the next one when a
+// backend fails. With hedging enabled, a backend that has not answered within
+// its own HedgePercentile latency gets a concurrent second request on the next
+// backend; the first success wins and the loser is cancelled.
+type Fallback struct {
+	backends []Backend
+	// hedgePercentile is in (0, 100); 0 disables hedging.
+	hedgePercentile float64
+
+	mu        sync.Mutex
+	latencies [][]time.Duration
+}
+
+// NewFallback returns a Fallback over backends. hedgePercentile outside
+// (0, 100) disables hedging.
+func NewFallback(backends []Backend, hedgePercentile float64) *Fallback {
+	if hedgePercentile <= 0 || hedgePercentile >= 100 {
+		hedgePercentile = 0
+	}
+	return &Fallback{
+		backends:        backends,
+		hedgePercentile: hedgePercentile,
+		latencies:       make([][]time.Duration, len(backends)),
+	}
+}
+
+type attempt struct {
+	index   int
+	resp    Response
+	err     error
+	elapsed time.Duration
+}
+
+// Dispatch returns the first successful response. Response.Backend names the
+// backend that produced it.
+func (f *Fallback) Dispatch(ctx context.Context, req Request) (Response, error) {
+	if len(f.backends) == 0 {
+		return Response{}, errors.New("no dispatch backends configured")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan attempt, len(f.backends))
+	next, running := 0, 0
+	start := func() int {
+		i := next
+		next++
+		running++
+		go func() {
+			begin := time.Now()
+			resp, err := f.backends[i].Dispatch(ctx, req)
+			results <- attempt{index: i, resp: resp, err: err, elapsed: time.Since(begin)}
+		}()
+		return i
+	}
+
+	var hedge *time.Timer
+	var hedgeC <-chan time.Time
+	arm := func(i int) {
+		if next >= len(f.backends) {
+			return
+		}
+		if delay, ok := f.hedgeDelay(i); ok {
+			hedge = time.NewTimer(delay)
+			hedgeC = hedge.C
+		}
+	}
+	defer func() {
+		if hedge != nil {
+			hedge.Stop()
+		}
+	}()
+
+	arm(start())
+	var errs []error
+	for running > 0 {
+		select {
+		case a := <-results:
+			running--
+			if a.err == nil {
+				f.observe(a.index, a.elapsed)
+				if a.resp.Backend == "" {
+					a.resp.Backend = f.backends[a.index].Name
+				}
+				return a.resp, nil
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", f.backends[a.index].Name, a.err))
+			if running == 0 && next < len(f.backends) && ctx.Err() == nil {
+				if hedge != nil {
+					hedge.Stop()
+					hedgeC = nil
+				}
+				arm(start())
+			}
+		case <-hedgeC:
+			hedgeC = nil
+			if next < len(f.backends) {
+				start()
+			}
+		}
+	}
+
+	if len(errs) == 1 {
+		return Response{}, errs[0]
+	}
+	return Response{}, fmt.Errorf("all %d backends failed: %w", len(errs), errors.Join(errs...))
+}
+
+// observe records a successful latency for backend i.
+func (f *Fallback) observe(i int, d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	window := append(f.latencies[i], d)
+	if len(window) > latencyWindow {
+		window = window[len(window)-latencyWindow:]
+	}
+	f.latencies[i] = window
+}
+
+// hedgeDelay reports backend i's hedgePercentile latency once it has enough history.
+func (f *Fallback) hedgeDelay(i int) (time.Duration, bool) {
+	if f.hedgePercentile == 0 {
+		return 0, false
+	}
+	f.mu.Lock()
+	window := append([]time.Duration(nil), f.latencies[i]...)
+	f.mu.Unlock()
+	if len(window) < minHedgeSamples {
+		return 0, false
+	}
+	return percentile(window, f.hedgePercentile), true
+}
+
+// percentile returns the nearest-rank p-th percentile of samples, sorting them in place.
+func percentile(samples []time.Duration, p float64) time.Duration {
+	sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+	rank := int(math.Ceil(p / 100 * float64(len(samples))))
+	return samples[max(rank-1, 0)]
+}
@@ -0,0 +1,202 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func failing(msg string) Dispatcher {
+	return Func(func(ctx context.Context, req Request) (Response, error) {
+		return Response{}, errors.New(msg)
+	})
+}
+
+func answering(output string) Dispatcher {
+	return Func(func(ctx context.Context, req Request) (Response, error) {
+		return Response{Output: output}, nil
+	})
+}
+
+func TestFallbackFallsThroughOnError(t *testing.T) {
+	f := NewFallback([]Backend{
+		{Name: "shell", Dispatcher: failing("dispatch.sh missing")},
+		{Name: "http", Dispatcher: answering("from http")},
+		{Name: "sampling", Dispatcher: answering("from sampling")},
+	}, 0)
+
+	resp, err := f.Dispatch(context.Background(), Request{Prompt: "q"})
+	if err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	if resp.Output != "from http" || resp.Backend != "http" {
+		t.Fatalf("expected the second backend to answer, got %+v", resp)
+	}
+}
+
+func TestFallbackKeepsBackendReportedName(t *testing.T) {
+	f := NewFallback([]Backend{{Name: "sampling", Dispatcher: Func(func(ctx context.Context, req Request) (Response, error) {
+		return Response{Output: "ok", Backend: "shell"}, nil
+	})}}, 0)
+
+	resp, err := f.Dispatch(context.Background(), Request{})
+	if err != nil || resp.Backend != "shell" {
+		t.Fatalf("expected the backend's own name to win, got %+v, %v", resp, err)
+	}
+}
+
+func TestFallbackReportsEveryFailure(t *testing.T) {
+	f := NewFallback([]Backend{
+		{Name: "shell", Dispatcher: failing("exit status 1")},
+		{Name: "http", Dispatcher: Func(func(ctx context.Context, req Request) (Response, error) {
+			return Response{}, ErrTimeout
+		})},
+	}, 0)
+
+	_, err := f.Dispatch(context.Background(), Request{})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	for _, want := range []string{"all 2 backends failed", "shell: exit status 1", "http: dispatch timed out"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q in %v", want, err)
+		}
+	}
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("joined error should still match ErrTimeout: %v", err)
+	}
+}
+
+func TestFallbackHedgesSlowPrimary(t *testing.T) {
+	g := newGate()
+	var primaryErr error
+	primaryDone := make(chan struct{})
+	primary := Func(func(ctx context.Context, req Request) (Response, error) {
+		defer close(primaryDone)
+		select {
+		case <-g.release:
+			return Response{Output: "primary"}, nil
+		case <-ctx.Done():
+			primaryErr = ctx.Err()
+			return Response{}, ctx.Err()
+		}
+	})
+	f := NewFallback([]Backend{
+		{Name: "shell", Dispatcher: primary},
+		{Name: "http", Dispatcher: answering("hedge")},
+	}, 95)
+	for i := 0; i < minHedgeSamples; i++ {
+		f.observe(0, time.Millisecond)
+	}
+
+	resp, err := f.Dispatch(context.Background(), Request{})
+	if err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	if resp.Output != "hedge" || resp.Backend != "http" {
+		t.Fatalf("expected the hedged request to win, got %+v", resp)
+	}
+	<-primaryDone
+	if !errors.Is(primaryErr, context.Canceled) {
+		t.Fatalf("losing request should be cancelled, got %v", primaryErr)
+	}
+}
+
+func TestFallbackHedgeWaitsForAPerBackendSlot(t *testing.T) {
+	limiter := NewLimiter(1, 1)
+	primary := Func(func(ctx context.Context, req Request) (Response, error) {
+		<-ctx.Done()
+		return Response{}, ctx.Err()
+	})
+	hedged := make(chan struct{})
+	hedge := Func(func(ctx context.Context, req Request) (Response, error) {
+		close(hedged)
+		return Response{Output: "hedge"}, nil
+	})
+	f := NewFallback([]Backend{
+		{Name: "shell", Dispatcher: Chain(primary, limiter.Middleware())},
+		{Name: "http", Dispatcher: Chain(hedge, limiter.Middleware())},
+	}, 95)
+	for i := 0; i < minHedgeSamples; i++ {
+		f.observe(0, time.Millisecond)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := f.Dispatch(ctx, Request{}); err == nil {
+		t.Fatal("expected the call to time out with both backends sharing one slot")
+	}
+	select {
+	case <-hedged:
+		t.Fatal("hedge ran while the primary held the only dispatch slot")
+	default:
+	}
+}
+
+func TestFallbackHedgeIsRecordedPerBackend(t *testing.T) {
+	ledger := NewLedger()
+	g := newGate()
+	primary := Func(func(ctx context.Context, req Request) (Response, error) {
+		select {
+		case <-g.release:
+			return Response{Output: "primary"}, nil
+		case <-ctx.Done():
+			return Response{}, ctx.Err()
+		}
+	})
+	f := NewFallback([]Backend{
+		{Name: "shell", Dispatcher: Chain(primary, ledger.Middleware())},
+		{Name: "http", Dispatcher: Chain(answering("hedge"), ledger.Middleware())},
+	}, 95)
+	for i := 0; i < minHedgeSamples; i++ {
+		f.observe(0, time.Millisecond)
+	}
+
+	if _, err := f.Dispatch(context.Background(), Request{Tool: "classify_sections", Prompt: "prompt"}); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	// The cancelled primary is recorded once it returns, after the hedge won.
+	var entry LedgerEntry
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if entry = ledger.Snapshot().ByTool["classify_sections"]; entry.Dispatches == 2 {
+			break
+		}
+	}
+	if entry.Dispatches != 2 || entry.Failures != 1 || entry.EstimatedPromptTokens != 2*EstimateTokens("prompt") {
+		t.Fatalf("expected the primary and the hedge in the ledger, got %+v", entry)
+	}
+}
+
+func TestFallbackDoesNotHedgeWithoutHistory(t *testing.T) {
+	calls := make(chan string, 2)
+	slow := Func(func(ctx context.Context, req Request) (Response, error) {
+		calls <- "shell"
+		time.Sleep(20 * time.Millisecond)
+		return Response{Output: "slow"}, nil
+	})
+	hedge := Func(func(ctx context.Context, req Request) (Response, error) {
+		calls <- "http"
+		return Response{Output: "hedge"}, nil
+	})
+	f := NewFallback([]Backend{{Name: "shell", Dispatcher: slow}, {Name: "http", Dispatcher: hedge}}, 50)
+
+	resp, err := f.Dispatch(context.Background(), Request{})
+	if err != nil || resp.Output != "slow" {
+		t.Fatalf("expected the primary to answer, got %+v, %v", resp, err)
+	}
+	if len(calls) != 1 {
+		t.Fatalf("expected no hedge without latency history, got %d calls", len(calls))
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	samples := []time.Duration{5, 1, 4, 2, 3, 10, 6, 8, 7, 9}
+	if got := percentile(samples, 50); got != 5 {
+		t.Fatalf("p50 = %d, want 5", got)
+	}
+	if got := percentile(samples, 95); got != 10 {
+		t.Fatalf("p95 = %d, want 10", got)
+	}
+}
@@ -0,0 +1,126 @@
+package dispatch
+
+import (
+	"context"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Usage is token and timing accounting for one or more dispatches. Estimated
+// counts are always present; PromptTokens/OutputTokens are only set when the
+// backend reports real usage.
+type Usage struct {
+	EstimatedPromptTokens int   `json:"estimated_prompt_tokens"`
+	EstimatedOutputTokens int   `json:"estimated_output_tokens"`
+	PromptTokens          int   `json:"prompt_tokens,omitempty"`
+	OutputTokens          int   `json:"output_tokens,omitempty"`
+	WallTimeMs            int64 `json:"wall_time_ms"`
+}
+
+// Add returns the field-wise sum of u and o.
+func (u Usage) Add(o Usage) Usage {
+	return Usage{
+		EstimatedPromptTokens: u.EstimatedPromptTokens + o.EstimatedPromptTokens,
+		EstimatedOutputTokens: u.EstimatedOutputTokens + o.EstimatedOutputTokens,
+		PromptTokens:          u.PromptTokens + o.PromptTokens,
+		OutputTokens:          u.OutputTokens + o.OutputTokens,
+		WallTimeMs:            u.WallTimeMs + o.WallTimeMs,
+	}
+}
+
+// EstimateTokens approximates the token count of s at ~4 characters per token.
+func EstimateTokens(s string) int {
+	return (utf8.RuneCountInString(s) + 3) / 4
+}
+
+// LedgerEntry accumulates usage for one tool.
+type LedgerEntry struct {
+	Dispatches int `json:"dispatches"`
+	Failures   int `json:"failures"`
+	Usage
+	// ContextTokensSaved estimates caller context avoided by delegating reads.
+	ContextTokensSaved int `json:"context_tokens_saved"`
+}
+
+// LedgerSnapshot is a point-in-time copy of a Ledger.
+type LedgerSnapshot struct {
+	Since  time.Time              `json:"since"`
+	Totals LedgerEntry            `json:"totals"`
+	ByTool map[string]LedgerEntry `json:"by_tool"`
+}
+
+// Ledger accumulates per-tool dispatch usage for the lifetime of the server
+// process, which for stdio transport is one MCP session.
+type Ledger struct {
+	mu     sync.Mutex
+	since  time.Time
+	byTool map[string]*LedgerEntry
+}
+
+// NewLedger returns an empty Ledger.
+func NewLedger() *Ledger {
+	return &Ledger{since: time.Now(), byTool: map[string]*LedgerEntry{}}
+}
+
+// Middleware fills Response.Usage (estimates and wall time, keeping any
+// backend-reported counts) and records it in the ledger.
+func (l *Ledger) Middleware() Middleware {
+	return func(next Dispatcher) Dispatcher {
+		return Func(func(ctx context.Context, req Request) (Response, error) {
+			start := time.Now()
+			resp, err := next.Dispatch(ctx, req)
+			resp.Usage.EstimatedPromptTokens = EstimateTokens(req.Prompt)
+			resp.Usage.EstimatedOutputTokens = EstimateTokens(resp.Output)
+			resp.Usage.WallTimeMs = time.Since(start).Milliseconds()
+
+			l.mu.Lock()
+			entry := l.entry(req.Tool)
+			entry.Dispatches++
+			if err != nil {
+				entry.Failures++
+			}
+			entry.Usage = entry.Usage.Add(resp.Usage)
+			l.mu.Unlock()
+			return resp, err
+		})
+	}
+}
+
+// RecordContextSaved credits tool with tokens the caller did not have to read.
+func (l *Ledger) RecordContextSaved(tool string, tokens int) {
+	if tokens <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entry(tool).ContextTokensSaved += tokens
+}
+
+// Snapshot returns a copy of the current totals.
+func (l *Ledger) Snapshot() LedgerSnapshot {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	snap := LedgerSnapshot{Since: l.since, ByTool: make(map[string]LedgerEntry, len(l.byTool))}
+	for tool, entry := range l.byTool {
+		snap.ByTool[tool] = *entry
+		snap.Totals.Dispatches += entry.Dispatches
+		snap.Totals.Failures += entry.Failures
+		snap.Totals.Usage = snap.Totals.Usage.Add(entry.Usage)
+		snap.Totals.ContextTokensSaved += entry.ContextTokensSaved
+	}
+	return snap
+}
+
+func (l *Ledger) entry(tool string) *LedgerEntry {
+	if tool == "" {
+		tool = "unknown"
+	}
+	entry := l.byTool[tool]
+	if entry == nil {
+		entry = &LedgerEntry{}
+		l.byTool[tool] = entry
+	}
+	return entry
+}
@@ -0,0 +1,54 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLedgerFillsUsageAndAccumulatesPerTool(t *testing.T) {
+	ledger := NewLedger()
+	backend := Func(func(ctx context.Context, req Request) (Response, error) {
+		if req.Prompt == "fail" {
+			return Response{}, errors.New("down")
+		}
+		return Response{Output: strings.Repeat("o", 40), Usage: Usage{PromptTokens: 7, OutputTokens: 3}}, nil
+	})
+	d := Chain(backend, ledger.Middleware())
+
+	resp, err := d.Dispatch(context.Background(), Request{Prompt: strings.Repeat("p", 100), Tool: "codex_query"})
+	if err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	if resp.Usage.EstimatedPromptTokens != 25 || resp.Usage.EstimatedOutputTokens != 10 {
+		t.Fatalf("unexpected estimates %+v", resp.Usage)
+	}
+	if resp.Usage.PromptTokens != 7 || resp.Usage.OutputTokens != 3 {
+		t.Fatalf("backend-reported usage should be preserved, got %+v", resp.Usage)
+	}
+
+	_, _ = d.Dispatch(context.Background(), Request{Prompt: "fail", Tool: "classify_sections"})
+	ledger.RecordContextSaved("codex_query", 500)
+
+	snap := ledger.Snapshot()
+	if snap.Totals.Dispatches != 2 || snap.Totals.Failures != 1 {
+		t.Fatalf("unexpected totals %+v", snap.Totals)
+	}
+	query := snap.ByTool["codex_query"]
+	if query.Dispatches != 1 || query.EstimatedPromptTokens != 25 || query.PromptTokens != 7 || query.ContextTokensSaved != 500 {
+		t.Fatalf("unexpected codex_query entry %+v", query)
+	}
+	if snap.ByTool["classify_sections"].Failures != 1 {
+		t.Fatalf("expected classify_sections failure to be recorded: %+v", snap.ByTool)
+	}
+}
+
+func TestEstimateTokensCountsRunes(t *testing.T) {
+	if got := EstimateTokens(""); got != 0 {
+		t.Fatalf("EstimateTokens(\"\") = %d", got)
+	}
+	if got := EstimateTokens("héllo"); got != 2 {
+		t.Fatalf("EstimateTokens(héllo) = %d, want 2", got)
+	}
+}
@@ -0,0 +1,166 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMaxInFlight = 4
+	DefaultMaxQueue    = 32
+)
+
+// ErrOverloaded is returned when the dispatch queue is full.
+var ErrOverloaded = errors.New("dispatch overloaded")
+
+// Limiter bounds concurrent dispatches. Requests beyond MaxInFlight wait in a
+// bounded queue; freed slots are handed out round-robin across Request.Tool so
+// a burst from one tool cannot starve another.
+type Limiter struct {
+	maxInFlight int
+	maxQueue    int
+
+	mu       sync.Mutex
+	inFlight int
+	queued   int
+	queues   map[string][]*waiter
+	order    []string // tools with waiters, in round-robin order
+	next     int
+}
+
+type waiter struct {
+	ready chan struct{}
+}
+
+// NewLimiter returns a Limiter; non-positive values select the defaults.
+func NewLimiter(maxInFlight, maxQueue int) *Limiter {
+	if maxInFlight <= 0 {
+		maxInFlight = DefaultMaxInFlight
+	}
+	if maxQueue <= 0 {
+		maxQueue = DefaultMaxQueue
+	}
+	return &Limiter{
+		maxInFlight: maxInFlight,
+		maxQueue:    maxQueue,
+		queues:      map[string][]*waiter{},
+	}
+}
+
+// Middleware returns a Middleware that routes dispatches through l.
+func (l *Limiter) Middleware() Middleware {
+	return func(next Dispatcher) Dispatcher {
+		return Func(func(ctx context.Context, req Request) (Response, error) {
+			wait, err := l.acquire(ctx, req.Tool)
+			if err != nil {
+				return Response{QueueWait: wait}, err
+			}
+			defer l.release()
+
+			resp, err := next.Dispatch(ctx, req)
+			resp.QueueWait += wait
+			return resp, err
+		})
+	}
+}
+
+// Stats reports current in-flight and queued dispatch counts.
+func (l *Limiter) Stats() (inFlight, queued int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight, l.queued
+}
+
+func (l *Limiter) acquire(ctx context.Context, tool string) (time.Duration, error) {
+	l.mu.Lock()
+	if l.inFlight < l.maxInFlight && l.queued == 0 {
+		l.inFlight++
+		l.mu.Unlock()
+		return 0, nil
+	}
+	if l.queued >= l.maxQueue {
+		inFlight, queued := l.inFlight, l.queued
+		l.mu.Unlock()
+		return 0, fmt.Errorf("%w: %d in flight, %d queued", ErrOverloaded, inFlight, queued)
+	}
+
+	w := &waiter{ready: make(chan struct{})}
+	if len(l.queues[tool]) == 0 {
+		l.order = append(l.order, tool)
+	}
+	l.queues[tool] = append(l.queues[tool], w)
+	l.queued++
+	l.mu.Unlock()
+
+	start := time.Now()
+	select {
+	case <-w.ready:
+		return time.Since(start), nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		if l.removeWaiter(tool, w) {
+			l.mu.Unlock()
+			return time.Since(start), ctx.Err()
+		}
+		l.mu.Unlock()
+		// The slot was handed over concurrently with cancellation; give it back.
+		l.release()
+		return time.Since(start), ctx.Err()
+	}
+}
+
+// release hands the caller's slot to the next waiter, or frees it.
+func (l *Limiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.queued == 0 {
+		l.inFlight--
+		return
+	}
+
+	if l.next >= len(l.order) {
+		l.next = 0
+	}
+	tool := l.order[l.next]
+	queue := l.queues[tool]
+	w := queue[0]
+	l.queues[tool] = queue[1:]
+	l.queued--
+
+	if len(l.queues[tool]) == 0 {
+		delete(l.queues, tool)
+		l.order = append(l.order[:l.next], l.order[l.next+1:]...)
+	} else {
+		l.next++
+	}
+	close(w.ready)
+}
+
+func (l *Limiter) removeWaiter(tool string, target *waiter) bool {
+	queue := l.queues[tool]
+	for i, w := range queue {
+		if w != target {
+			continue
+		}
+		l.queues[tool] = append(queue[:i], queue[i+1:]...)
+		l.queued--
+		if len(l.queues[tool]) == 0 {
+			delete(l.queues, tool)
+			for j, name := range l.order {
+				if name == tool {
+					l.order = append(l.order[:j], l.order[j+1:]...)
+					if l.next > j {
+						l.next--
+					}
+					break
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
@@ -0,0 +1,152 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gate is a backend that blocks every dispatch until released.
+type gate struct {
+	mu      sync.Mutex
+	started []string
+	release chan struct{}
+	entered chan struct{}
+}
+
+func newGate() *gate {
+	return &gate{release: make(chan struct{}), entered: make(chan struct{}, 64)}
+}
+
+func (g *gate) Dispatch(ctx context.Context, req Request) (Response, error) {
+	g.mu.Lock()
+	g.started = append(g.started, req.Tool)
+	g.mu.Unlock()
+	g.entered <- struct{}{}
+	<-g.release
+	return Response{Output: req.Prompt}, nil
+}
+
+func waitQueued(t *testing.T, l *Limiter, want int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, queued := l.Stats(); queued == want {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d queued dispatches", want)
+}
+
+func TestLimiterBoundsInFlight(t *testing.T) {
+	g := newGate()
+	l := NewLimiter(2, 10)
+	d := Chain(g, l.Middleware())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = d.Dispatch(context.Background(), Request{Tool: "codex_query"})
+		}()
+	}
+
+	<-g.entered
+	<-g.entered
+	waitQueued(t, l, 3)
+	if inFlight, _ := l.Stats(); inFlight != 2 {
+		t.Fatalf("expected 2 in flight, got %d", inFlight)
+	}
+
+	close(g.release)
+	wg.Wait()
+	if inFlight, queued := l.Stats(); inFlight != 0 || queued != 0 {
+		t.Fatalf("expected idle limiter, got %d in flight, %d queued", inFlight, queued)
+	}
+}
+
+func TestLimiterRejectsWhenQueueFull(t *testing.T) {
+	g := newGate()
+	l := NewLimiter(1, 1)
+	d := Chain(g, l.Middleware())
+
+	go func() { _, _ = d.Dispatch(context.Background(), Request{}) }()
+	<-g.entered
+	go func() { _, _ = d.Dispatch(context.Background(), Request{}) }()
+	waitQueued(t, l, 1)
+
+	_, err := d.Dispatch(context.Background(), Request{})
+	if !errors.Is(err, ErrOverloaded) {
+		t.Fatalf("expected ErrOverloaded, got %v", err)
+	}
+	close(g.release)
+}
+
+func TestLimiterRoundRobinsAcrossTools(t *testing.T) {
+	g := newGate()
+	l := NewLimiter(1, 10)
+	d := Chain(g, l.Middleware())
+
+	go func() { _, _ = d.Dispatch(context.Background(), Request{Tool: "first"}) }()
+	<-g.entered
+
+	// Queue three codex_query requests ahead of one classify_sections request.
+	for i, tool := range []string{"codex_query", "codex_query", "codex_query", "classify_sections"} {
+		go func() { _, _ = d.Dispatch(context.Background(), Request{Tool: tool}) }()
+		waitQueued(t, l, i+1)
+	}
+
+	for i := 0; i < 4; i++ {
+		g.release <- struct{}{}
+		<-g.entered
+	}
+	g.release <- struct{}{}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.started[2] != "classify_sections" {
+		t.Fatalf("classify_sections should be served second from the queue, got order %v", g.started)
+	}
+}
+
+func TestLimiterReportsQueueWaitAndHonorsCancellation(t *testing.T) {
+	g := newGate()
+	l := NewLimiter(1, 10)
+	d := Chain(g, l.Middleware())
+
+	go func() { _, _ = d.Dispatch(context.Background(), Request{}) }()
+	<-g.entered
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		_, err := d.Dispatch(ctx, Request{})
+		errc <- err
+	}()
+	waitQueued(t, l, 1)
+	cancel()
+	if err := <-errc; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if _, queued := l.Stats(); queued != 0 {
+		t.Fatalf("cancelled waiter should leave the queue, %d still queued", queued)
+	}
+
+	respc := make(chan Response, 1)
+	go func() {
+		resp, _ := d.Dispatch(context.Background(), Request{Prompt: "late"})
+		respc <- resp
+	}()
+	waitQueued(t, l, 1)
+	time.Sleep(20 * time.Millisecond)
+	g.release <- struct{}{}
+	<-g.entered
+	g.release <- struct{}{}
+	if resp := <-respc; resp.QueueWait < 20*time.Millisecond {
+		t.Fatalf("expected queue wait >= 20ms, got %v", resp.QueueWait)
+	}
+}
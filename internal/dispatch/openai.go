@@ -0,0 +1,179 @@
+package dispatch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const maxErrorBodyBytes = 512
+
+// OpenAI dispatches prompts to any OpenAI-compatible chat-completions endpoint
+// (OpenAI, vLLM, llama.cpp server, Ollama, LM Studio, ...).
+type OpenAI struct {
+	// BaseURL is the API root, e.g. "http://localhost:11434/v1".
+	BaseURL string
+	// Model is used for the fast tier.
+	Model string
+	// DeepModel is used for the deep tier; falls back to Model when empty.
+	DeepModel string
+	// APIKey is sent as a bearer token when non-empty.
+	APIKey string
+	// DisableSchema stops Request.Schema being sent as a json_schema
+	// response_format, for servers without structured output support.
+	DisableSchema bool
+	Client        *http.Client
+}
+
+// NewOpenAIFromEnv configures an OpenAI backend from INTERSERVE_OPENAI_* variables.
+func NewOpenAIFromEnv() (*OpenAI, error) {
+	o := &OpenAI{
+		BaseURL:   strings.TrimSpace(os.Getenv("INTERSERVE_OPENAI_BASE_URL")),
+		Model:     strings.TrimSpace(os.Getenv("INTERSERVE_OPENAI_MODEL")),
+		DeepModel: strings.TrimSpace(os.Getenv("INTERSERVE_OPENAI_DEEP_MODEL")),
+		APIKey:    strings.TrimSpace(os.Getenv("INTERSERVE_OPENAI_API_KEY")),
+	}
+	switch v := strings.TrimSpace(os.Getenv("INTERSERVE_OPENAI_STRUCTURED_OUTPUT")); v {
+	case "", "on":
+	case "off":
+		o.DisableSchema = true
+	default:
+		return nil, fmt.Errorf("invalid INTERSERVE_OPENAI_STRUCTURED_OUTPUT %q: must be on or off", v)
+	}
+	if o.BaseURL == "" {
+		return nil, fmt.Errorf("INTERSERVE_OPENAI_BASE_URL is required for the http backend")
+	}
+	if o.Model == "" {
+		return nil, fmt.Errorf("INTERSERVE_OPENAI_MODEL is required for the http backend")
+	}
+	return o, nil
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model          string          `json:"model"`
+	Messages       []chatMessage   `json:"messages"`
+	ResponseFormat *responseFormat `json:"response_format,omitempty"`
+}
+
+type responseFormat struct {
+	Type       string     `json:"type"`
+	JSONSchema jsonSchema `json:"json_schema"`
+}
+
+type jsonSchema struct {
+	Name   string          `json:"name"`
+	Strict bool            `json:"strict"`
+	Schema json.RawMessage `json:"schema"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+// Dispatch sends the prompt as a single user message and returns the first choice.
+func (o *OpenAI) Dispatch(ctx context.Context, req Request) (Response, error) {
+	model := o.Model
+	if req.Tier == TierDeep && o.DeepModel != "" {
+		model = o.DeepModel
+	}
+
+	chat := chatRequest{
+		Model:    model,
+		Messages: []chatMessage{{Role: "user", Content: req.Prompt}},
+	}
+	if len(req.Schema) > 0 && !o.DisableSchema {
+		chat.ResponseFormat = &responseFormat{
+			Type:       "json_schema",
+			JSONSchema: jsonSchema{Name: schemaName(req.Tool), Strict: true, Schema: req.Schema},
+		}
+	}
+	body, err := json.Marshal(chat)
+	if err != nil {
+		return Response{}, fmt.Errorf("marshal chat request: %w", err)
+	}
+
+	url := strings.TrimRight(o.BaseURL, "/") + "/chat/completions"
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return Response{}, fmt.Errorf("build chat request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if o.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+o.APIKey)
+	}
+
+	client := o.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	start := time.Now()
+	httpResp, err := client.Do(httpReq)
+	if err != nil {
+		return Response{}, fmt.Errorf("post %s: %w", url, err)
+	}
+	defer httpResp.Body.Close()
+
+	raw, err := io.ReadAll(httpResp.Body)
+	if err != nil {
+		return Response{}, fmt.Errorf("read chat response: %w", err)
+	}
+	if httpResp.StatusCode/100 != 2 {
+		snippet := strings.TrimSpace(string(raw))
+		if len(snippet) > maxErrorBodyBytes {
+			snippet = snippet[:maxErrorBodyBytes]
+		}
+		return Response{}, fmt.Errorf("chat completions returned %s: %s", httpResp.Status, snippet)
+	}
+
+	var decoded chatResponse
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		return Response{}, fmt.Errorf("decode chat response: %w", err)
+	}
+	if len(decoded.Choices) == 0 {
+		return Response{}, fmt.Errorf("chat completions returned no choices")
+	}
+
+	resp := Response{
+		Output:   strings.TrimSpace(decoded.Choices[0].Message.Content),
+		Backend:  "http",
+		Duration: time.Since(start),
+	}
+	if decoded.Usage != nil {
+		resp.Usage.PromptTokens = decoded.Usage.PromptTokens
+		resp.Usage.OutputTokens = decoded.Usage.CompletionTokens
+	}
+	return resp, nil
+}
+
+// schemaName derives a response_format name (letters, digits, _ and - only) from tool.
+func schemaName(tool string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		}
+		return '_'
+	}, tool)
+	if name == "" {
+		return "response"
+	}
+	return name
+}
@@ -0,0 +1,139 @@
+package dispatch
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOpenAIDispatchSendsChatCompletion(t *testing.T) {
+	var got chatRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("unexpected path %q", r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer secret" {
+			t.Errorf("unexpected authorization header %q", auth)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode request: %v", err)
+		}
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"  answer  "}}]}`))
+	}))
+	defer srv.Close()
+
+	o := &OpenAI{BaseURL: srv.URL + "/v1/", Model: "small", DeepModel: "large", APIKey: "secret"}
+	resp, err := o.Dispatch(context.Background(), Request{Prompt: "question", Tier: TierDeep})
+	if err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	if resp.Output != "answer" || resp.Backend != "http" {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	if got.Model != "large" {
+		t.Fatalf("deep tier should use DeepModel, got %q", got.Model)
+	}
+	if len(got.Messages) != 1 || got.Messages[0].Role != "user" || got.Messages[0].Content != "question" {
+		t.Fatalf("unexpected messages %+v", got.Messages)
+	}
+}
+
+func TestOpenAIDispatchFastTierUsesModel(t *testing.T) {
+	var got chatRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"ok"}}],"usage":{"prompt_tokens":12,"completion_tokens":1}}`))
+	}))
+	defer srv.Close()
+
+	o := &OpenAI{BaseURL: srv.URL, Model: "small", DeepModel: "large"}
+	resp, err := o.Dispatch(context.Background(), Request{Prompt: "q", Tier: TierFast})
+	if err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	if got.Model != "small" {
+		t.Fatalf("fast tier should use Model, got %q", got.Model)
+	}
+	if resp.Usage.PromptTokens != 12 || resp.Usage.OutputTokens != 1 {
+		t.Fatalf("expected reported usage, got %+v", resp.Usage)
+	}
+}
+
+func TestOpenAIDispatchSendsSchemaAsResponseFormat(t *testing.T) {
+	var got map[string]json.RawMessage
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = nil
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"content":"{}"}}]}`))
+	}))
+	defer srv.Close()
+
+	schema := json.RawMessage(`{"type":"object"}`)
+	o := &OpenAI{BaseURL: srv.URL, Model: "small"}
+	if _, err := o.Dispatch(context.Background(), Request{Prompt: "q", Tool: "classify_sections", Schema: schema}); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	want := `{"type":"json_schema","json_schema":{"name":"classify_sections","strict":true,"schema":{"type":"object"}}}`
+	if string(got["response_format"]) != want {
+		t.Fatalf("response_format = %s, want %s", got["response_format"], want)
+	}
+
+	o.DisableSchema = true
+	if _, err := o.Dispatch(context.Background(), Request{Prompt: "q", Schema: schema}); err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	if _, ok := got["response_format"]; ok {
+		t.Fatal("response_format should be omitted when DisableSchema is set")
+	}
+}
+
+func TestOpenAIDispatchReportsHTTPErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "model not loaded", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	o := &OpenAI{BaseURL: srv.URL, Model: "small"}
+	_, err := o.Dispatch(context.Background(), Request{Prompt: "q"})
+	if err == nil || !strings.Contains(err.Error(), "503") || !strings.Contains(err.Error(), "model not loaded") {
+		t.Fatalf("expected status and body in error, got %v", err)
+	}
+}
+
+func TestOpenAIDispatchRejectsEmptyChoices(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"choices":[]}`))
+	}))
+	defer srv.Close()
+
+	o := &OpenAI{BaseURL: srv.URL, Model: "small"}
+	if _, err := o.Dispatch(context.Background(), Request{Prompt: "q"}); err == nil {
+		t.Fatal("expected error for empty choices")
+	}
+}
+
+func TestNewOpenAIFromEnvRequiresBaseURLAndModel(t *testing.T) {
+	t.Setenv("INTERSERVE_OPENAI_BASE_URL", "")
+	t.Setenv("INTERSERVE_OPENAI_MODEL", "m")
+	if _, err := NewOpenAIFromEnv(); err == nil {
+		t.Fatal("expected error without base URL")
+	}
+
+	t.Setenv("INTERSERVE_OPENAI_BASE_URL", "http://localhost:8080/v1")
+	t.Setenv("INTERSERVE_OPENAI_MODEL", "")
+	if _, err := NewOpenAIFromEnv(); err == nil {
+		t.Fatal("expected error without model")
+	}
+
+	t.Setenv("INTERSERVE_OPENAI_MODEL", "m")
+	o, err := NewOpenAIFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if o.BaseURL != "http://localhost:8080/v1" || o.Model != "m" {
+		t.Fatalf("unexpected config %+v", o)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package dispatch
+
+import "os/exec"
+
+// Process groups are unix-only; elsewhere only the direct child is killed.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func terminateGroup(cmd *exec.Cmd) {
+	_ = cmd.Process.Kill()
+}
+
+func killGroup(cmd *exec.Cmd) {
+	_ = cmd.Process.Kill()
+}
@@ -0,0 +1,112 @@
+//go:build unix
+
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestShellTimeoutKillsWholeProcessGroup(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "grandchild.pid")
+	script := writeScript(t, `
+sleep 30 &
+echo $! > "`+pidFile+`"
+wait
+`)
+
+	shell := &Shell{Path: script, Timeout: 200 * time.Millisecond, KillGrace: time.Second}
+	start := time.Now()
+	_, err := shell.Dispatch(context.Background(), Request{Prompt: "p"})
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("dispatch took %v, expected prompt termination", elapsed)
+	}
+
+	assertProcessGone(t, pidFile)
+}
+
+func TestShellEscalatesToSIGKILL(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "stubborn.pid")
+	script := writeScript(t, `
+trap '' TERM
+echo $$ > "`+pidFile+`"
+while true; do sleep 0.05; done
+`)
+
+	shell := &Shell{Path: script, Timeout: 200 * time.Millisecond, KillGrace: 200 * time.Millisecond}
+	_, err := shell.Dispatch(context.Background(), Request{Prompt: "p"})
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+	assertProcessGone(t, pidFile)
+}
+
+func TestShellKillsGrandchildIgnoringTERMAfterBashExits(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "grandchild.pid")
+	script := writeScript(t, `
+( trap '' TERM; exec sleep 30 ) >/dev/null 2>&1 &
+echo $! > "`+pidFile+`"
+wait
+`)
+
+	shell := &Shell{Path: script, Timeout: 200 * time.Millisecond, KillGrace: 200 * time.Millisecond}
+	_, err := shell.Dispatch(context.Background(), Request{Prompt: "p"})
+	if !errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected ErrTimeout, got %v", err)
+	}
+	assertProcessGone(t, pidFile)
+}
+
+func TestShellCancellationIsNotATimeout(t *testing.T) {
+	script := writeScript(t, `sleep 30`)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	_, err := NewShell(script).Dispatch(ctx, Request{Prompt: "p"})
+	if !errors.Is(err, context.Canceled) || errors.Is(err, ErrTimeout) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func assertProcessGone(t *testing.T, pidFile string) {
+	t.Helper()
+	raw, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatalf("read pid file: %v", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(raw)))
+	if err != nil {
+		t.Fatalf("parse pid: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if err := syscall.Kill(pid, 0); errors.Is(err, syscall.ESRCH) || isZombie(pid) {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("process %d survived dispatch termination", pid)
+}
+
+// isZombie reports whether pid has exited but not been reaped, as happens to a
+// killed grandchild whose new parent is slow to wait on it. It relies on
+// /proc, so it is always false where there is none.
+func isZombie(pid int) bool {
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return false
+	}
+	_, after, ok := strings.Cut(string(stat), ") ")
+	return ok && strings.HasPrefix(after, "Z")
+}
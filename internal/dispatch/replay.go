@@ -0,0 +1,115 @@
+package dispatch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrNoFixture is returned by Replayer when no recording matches a request.
+var ErrNoFixture = errors.New("no recorded fixture")
+
+// Fixture is one recorded prompt/response pair. The prompt is stored line by
+// line so prompt changes show up as readable fixture diffs.
+type Fixture struct {
+	Tool   string   `json:"tool,omitempty"`
+	Tier   string   `json:"tier"`
+	Prompt []string `json:"prompt"`
+	Output string   `json:"output"`
+}
+
+// FixtureKey identifies a request by tier and prompt content.
+func FixtureKey(req Request) string {
+	tier := req.Tier
+	if tier == "" {
+		tier = TierFast
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s", tier, req.Prompt)
+	return fmt.Sprintf("%x", h.Sum(nil))[:16]
+}
+
+// FixturePath returns where the fixture for req lives under dir.
+func FixturePath(dir string, req Request) string {
+	return filepath.Join(dir, FixtureKey(req)+".json")
+}
+
+// Recorder passes requests to Next and writes each successful exchange to Dir.
+type Recorder struct {
+	Next Dispatcher
+	Dir  string
+}
+
+// NewRecorder returns a Recorder writing fixtures for next into dir.
+func NewRecorder(next Dispatcher, dir string) *Recorder {
+	return &Recorder{Next: next, Dir: dir}
+}
+
+// Dispatch forwards to Next and records the response.
+func (r *Recorder) Dispatch(ctx context.Context, req Request) (Response, error) {
+	resp, err := r.Next.Dispatch(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+
+	tier := req.Tier
+	if tier == "" {
+		tier = TierFast
+	}
+	fixture := Fixture{
+		Tool:   req.Tool,
+		Tier:   tier,
+		Prompt: strings.Split(req.Prompt, "\n"),
+		Output: resp.Output,
+	}
+	encoded, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return resp, fmt.Errorf("marshal fixture: %w", err)
+	}
+	if err := os.MkdirAll(r.Dir, 0o755); err != nil {
+		return resp, fmt.Errorf("create fixture dir %q: %w", r.Dir, err)
+	}
+	if err := os.WriteFile(FixturePath(r.Dir, req), append(encoded, '\n'), 0o644); err != nil {
+		return resp, fmt.Errorf("write fixture: %w", err)
+	}
+	return resp, nil
+}
+
+// Replayer serves recorded fixtures from Dir without contacting any backend.
+type Replayer struct {
+	Dir string
+}
+
+// NewReplayer returns a Replayer reading fixtures from dir.
+func NewReplayer(dir string) *Replayer {
+	return &Replayer{Dir: dir}
+}
+
+// Dispatch returns the recorded output for req, or ErrNoFixture.
+func (r *Replayer) Dispatch(ctx context.Context, req Request) (Response, error) {
+	start := time.Now()
+	path := FixturePath(r.Dir, req)
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Response{}, fmt.Errorf("%w for %s prompt %s (re-record with INTERSERVE_RECORD_DIR=%s)", ErrNoFixture, req.Tool, FixtureKey(req), r.Dir)
+	}
+	if err != nil {
+		return Response{}, fmt.Errorf("read fixture: %w", err)
+	}
+
+	var fixture Fixture
+	if err := json.Unmarshal(raw, &fixture); err != nil {
+		return Response{}, fmt.Errorf("decode fixture %s: %w", path, err)
+	}
+	return Response{
+		Output:   fixture.Output,
+		Backend:  "replay",
+		Duration: time.Since(start),
+	}, nil
+}
@@ -0,0 +1,76 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestRecorderThenReplayerRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	calls := 0
+	live := Func(func(ctx context.Context, req Request) (Response, error) {
+		calls++
+		return Response{Output: "answer to " + req.Prompt, Backend: "live"}, nil
+	})
+
+	req := Request{Prompt: "line one\nline two", Tier: TierFast, Tool: "codex_query"}
+	if _, err := NewRecorder(live, dir).Dispatch(context.Background(), req); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+
+	raw, err := os.ReadFile(FixturePath(dir, req))
+	if err != nil {
+		t.Fatalf("fixture not written: %v", err)
+	}
+	if !strings.Contains(string(raw), `"line two"`) {
+		t.Fatalf("fixture should store prompt line by line:\n%s", raw)
+	}
+
+	resp, err := NewReplayer(dir).Dispatch(context.Background(), req)
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if resp.Output != "answer to line one\nline two" || resp.Backend != "replay" {
+		t.Fatalf("unexpected replay %+v", resp)
+	}
+	if calls != 1 {
+		t.Fatalf("replay should not call the live backend, calls=%d", calls)
+	}
+}
+
+func TestReplayerMissingFixture(t *testing.T) {
+	_, err := NewReplayer(t.TempDir()).Dispatch(context.Background(), Request{Prompt: "unrecorded"})
+	if !errors.Is(err, ErrNoFixture) {
+		t.Fatalf("expected ErrNoFixture, got %v", err)
+	}
+}
+
+func TestFixtureKeyDependsOnTierAndPrompt(t *testing.T) {
+	base := FixtureKey(Request{Prompt: "p", Tier: TierFast})
+	if base != FixtureKey(Request{Prompt: "p"}) {
+		t.Fatal("empty tier should key like the fast tier")
+	}
+	if base == FixtureKey(Request{Prompt: "p", Tier: TierDeep}) {
+		t.Fatal("tier should change the fixture key")
+	}
+	if base == FixtureKey(Request{Prompt: "p2", Tier: TierFast}) {
+		t.Fatal("prompt should change the fixture key")
+	}
+}
+
+func TestRecorderDoesNotRecordFailures(t *testing.T) {
+	dir := t.TempDir()
+	failing := Func(func(ctx context.Context, req Request) (Response, error) {
+		return Response{}, errors.New("down")
+	})
+	req := Request{Prompt: "p"}
+	if _, err := NewRecorder(failing, dir).Dispatch(context.Background(), req); err == nil {
+		t.Fatal("expected error to pass through")
+	}
+	if _, err := os.Stat(FixturePath(dir, req)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("failed dispatch should not be recorded, stat err=%v", err)
+	}
+}
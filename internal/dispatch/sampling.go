@@ -0,0 +1,104 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const defaultSamplingMaxTokens = 4096
+
+// ErrSamplingUnsupported is returned when the connected client does not
+// advertise sampling and no fallback dispatcher is configured.
+var ErrSamplingUnsupported = errors.New("client does not support sampling")
+
+// Sampling dispatches prompts back to the connected MCP client via
+// sampling/createMessage, so the host's own model does the work.
+type Sampling struct {
+	Server *server.MCPServer
+	// Fallback handles requests when the client lacks sampling support.
+	Fallback Dispatcher
+	// MaxTokens caps the sampled completion; defaults to 4096.
+	MaxTokens int
+}
+
+// NewSampling returns a Sampling dispatcher. fallback may be nil.
+func NewSampling(s *server.MCPServer, fallback Dispatcher) *Sampling {
+	return &Sampling{Server: s, Fallback: fallback}
+}
+
+// Dispatch requests a completion from the client, or delegates to Fallback when
+// the session did not declare the sampling capability.
+func (s *Sampling) Dispatch(ctx context.Context, req Request) (Response, error) {
+	if !clientSupportsSampling(ctx) {
+		if s.Fallback != nil {
+			return s.Fallback.Dispatch(ctx, req)
+		}
+		return Response{}, ErrSamplingUnsupported
+	}
+
+	maxTokens := s.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = defaultSamplingMaxTokens
+	}
+
+	request := mcp.CreateMessageRequest{
+		CreateMessageParams: mcp.CreateMessageParams{
+			Messages: []mcp.SamplingMessage{{
+				Role:    mcp.RoleUser,
+				Content: mcp.NewTextContent(req.Prompt),
+			}},
+			ModelPreferences: samplingPreferences(req.Tier),
+			MaxTokens:        maxTokens,
+		},
+	}
+
+	start := time.Now()
+	result, err := s.Server.RequestSampling(ctx, request)
+	if err != nil {
+		return Response{}, fmt.Errorf("sampling request: %w", err)
+	}
+
+	text, ok := samplingText(result.Content)
+	if !ok {
+		return Response{}, fmt.Errorf("sampling returned non-text content %T", result.Content)
+	}
+	return Response{
+		Output:   text,
+		Backend:  "sampling",
+		Duration: time.Since(start),
+	}, nil
+}
+
+func clientSupportsSampling(ctx context.Context) bool {
+	session, ok := server.ClientSessionFromContext(ctx).(server.SessionWithClientInfo)
+	if !ok {
+		return false
+	}
+	return session.GetClientCapabilities().Sampling != nil
+}
+
+// samplingPreferences maps dispatch tiers onto MCP model preference priorities.
+func samplingPreferences(tier string) *mcp.ModelPreferences {
+	if tier == TierDeep {
+		return &mcp.ModelPreferences{IntelligencePriority: 0.9, SpeedPriority: 0.2}
+	}
+	return &mcp.ModelPreferences{SpeedPriority: 0.9, CostPriority: 0.7, IntelligencePriority: 0.3}
+}
+
+func samplingText(content any) (string, bool) {
+	switch c := content.(type) {
+	case mcp.TextContent:
+		return c.Text, true
+	case *mcp.TextContent:
+		return c.Text, true
+	case map[string]any:
+		text, ok := c["text"].(string)
+		return text, ok
+	}
+	return "", false
+}
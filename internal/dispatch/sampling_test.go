@@ -0,0 +1,84 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+type fakeSamplingHandler struct {
+	got mcp.CreateMessageRequest
+}
+
+func (h *fakeSamplingHandler) CreateMessage(ctx context.Context, req mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+	h.got = req
+	return &mcp.CreateMessageResult{
+		SamplingMessage: mcp.SamplingMessage{
+			Role:    mcp.RoleAssistant,
+			Content: mcp.NewTextContent("sampled answer"),
+		},
+		Model: "client-model",
+	}, nil
+}
+
+func TestSamplingDispatchUsesClientModel(t *testing.T) {
+	srv := server.NewMCPServer("test", "0.0.0")
+	srv.EnableSampling()
+
+	handler := &fakeSamplingHandler{}
+	session := server.NewInProcessSession("s1", handler)
+	session.SetClientCapabilities(mcp.ClientCapabilities{Sampling: &struct{}{}})
+	ctx := srv.WithContext(context.Background(), session)
+
+	fallback := Func(func(ctx context.Context, req Request) (Response, error) {
+		t.Fatal("fallback should not be used when client supports sampling")
+		return Response{}, nil
+	})
+
+	resp, err := NewSampling(srv, fallback).Dispatch(ctx, Request{Prompt: "classify this", Tier: TierDeep})
+	if err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	if resp.Output != "sampled answer" || resp.Backend != "sampling" {
+		t.Fatalf("unexpected response %+v", resp)
+	}
+	if len(handler.got.Messages) != 1 {
+		t.Fatalf("expected one sampling message, got %d", len(handler.got.Messages))
+	}
+	if text, ok := samplingText(handler.got.Messages[0].Content); !ok || text != "classify this" {
+		t.Fatalf("unexpected sampling prompt %v", handler.got.Messages[0].Content)
+	}
+	if handler.got.ModelPreferences == nil || handler.got.ModelPreferences.IntelligencePriority < 0.5 {
+		t.Fatalf("deep tier should prefer intelligence, got %+v", handler.got.ModelPreferences)
+	}
+}
+
+func TestSamplingFallsBackWhenClientLacksCapability(t *testing.T) {
+	srv := server.NewMCPServer("test", "0.0.0")
+	session := server.NewInProcessSession("s1", &fakeSamplingHandler{})
+	ctx := srv.WithContext(context.Background(), session)
+
+	fallback := Func(func(ctx context.Context, req Request) (Response, error) {
+		return Response{Output: "from shell", Backend: "shell"}, nil
+	})
+
+	resp, err := NewSampling(srv, fallback).Dispatch(ctx, Request{Prompt: "p"})
+	if err != nil {
+		t.Fatalf("dispatch: %v", err)
+	}
+	if resp.Backend != "shell" {
+		t.Fatalf("expected fallback backend, got %q", resp.Backend)
+	}
+}
+
+func TestSamplingWithoutFallbackReportsUnsupported(t *testing.T) {
+	srv := server.NewMCPServer("test", "0.0.0")
+
+	_, err := NewSampling(srv, nil).Dispatch(context.Background(), Request{Prompt: "p"})
+	if !errors.Is(err, ErrSamplingUnsupported) {
+		t.Fatalf("expected ErrSamplingUnsupported, got %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+package dispatch
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultShellTimeout   = 5 * time.Minute
+	DefaultShellKillGrace = 5 * time.Second
+)
+
+// ErrTimeout is returned when a dispatch exceeds its deadline.
+var ErrTimeout = errors.New("dispatch timed out")
+
+// Shell dispatches prompts through Clavain's dispatch.sh.
+type Shell struct {
+	Path string
+	// Timeout bounds each dispatch; zero means no per-call deadline.
+	Timeout time.Duration
+	// KillGrace is how long the process group gets between SIGTERM and SIGKILL.
+	KillGrace time.Duration
+}
+
+// NewShell returns a Shell dispatcher for the script at path with default limits.
+func NewShell(path string) *Shell {
+	return &Shell{Path: path, Timeout: DefaultShellTimeout, KillGrace: DefaultShellKillGrace}
+}
+
+// Dispatch writes the prompt to a temp file, runs dispatch.sh against it and
+// returns the contents of the output file (or combined output if that is empty).
+func (s *Shell) Dispatch(ctx context.Context, req Request) (Response, error) {
+	tier := req.Tier
+	if tier == "" {
+		tier = TierFast
+	}
+
+	promptFile, err := os.CreateTemp("", "interserve-prompt-*.txt")
+	if err != nil {
+		return Response{}, fmt.Errorf("create prompt temp file: %w", err)
+	}
+	promptPath := promptFile.Name()
+	defer os.Remove(promptPath)
+
+	if _, err := promptFile.WriteString(req.Prompt); err != nil {
+		_ = promptFile.Close()
+		return Response{}, fmt.Errorf("write prompt temp file: %w", err)
+	}
+	if err := promptFile.Close(); err != nil {
+		return Response{}, fmt.Errorf("close prompt temp file: %w", err)
+	}
+
+	outputFile, err := os.CreateTemp("", "interserve-output-*.txt")
+	if err != nil {
+		return Response{}, fmt.Errorf("create output temp file: %w", err)
+	}
+	outputPath := outputFile.Name()
+	if err := outputFile.Close(); err != nil {
+		return Response{}, fmt.Errorf("close output temp file: %w", err)
+	}
+	defer os.Remove(outputPath)
+
+	if s.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Timeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	cmd := exec.Command(
+		"bash",
+		s.Path,
+		"--tier", tier,
+		"--sandbox", "read-only",
+		"--prompt-file", promptPath,
+		"-o", outputPath,
+	)
+	combined, err := s.run(ctx, cmd)
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			if errors.Is(ctxErr, context.DeadlineExceeded) {
+				return Response{}, fmt.Errorf("%w after %s", ErrTimeout, time.Since(start).Round(time.Millisecond))
+			}
+			return Response{}, ctxErr
+		}
+		stderr := strings.TrimSpace(string(combined))
+		if stderr == "" {
+			stderr = err.Error()
+		}
+		return Response{}, errors.New(stderr)
+	}
+
+	rawOutput, err := os.ReadFile(outputPath)
+	if err != nil {
+		return Response{}, fmt.Errorf("read dispatch output: %w", err)
+	}
+
+	output := strings.TrimSpace(string(rawOutput))
+	if output == "" {
+		output = strings.TrimSpace(string(combined))
+	}
+	return Response{
+		Output:   output,
+		Backend:  "shell",
+		Duration: time.Since(start),
+	}, nil
+}
+
+// run executes cmd in its own process group and returns its combined output.
+// When ctx ends, the whole group gets SIGTERM, then SIGKILL after KillGrace,
+// so Codex grandchildren cannot outlive the MCP call.
+func (s *Shell) run(ctx context.Context, cmd *exec.Cmd) ([]byte, error) {
+	var combined bytes.Buffer
+	cmd.Stdout = &combined
+	cmd.Stderr = &combined
+	setProcessGroup(cmd)
+
+	grace := s.KillGrace
+	if grace <= 0 {
+		grace = DefaultShellKillGrace
+	}
+	// Stop waiting on output pipes held open by a process that escaped the group.
+	cmd.WaitDelay = grace
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	select {
+	case err := <-done:
+		return combined.Bytes(), err
+	case <-ctx.Done():
+	}
+
+	terminateGroup(cmd)
+	// The group is killed when grace ends even if bash has already exited:
+	// a grandchild that ignores SIGTERM would otherwise outlive the call.
+	killed := make(chan struct{})
+	time.AfterFunc(grace, func() {
+		killGroup(cmd)
+		close(killed)
+	})
+	select {
+	case err := <-done:
+		return combined.Bytes(), err
+	case <-killed:
+	}
+	err := <-done
+	return combined.Bytes(), err
+}
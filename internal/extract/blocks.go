@@ -0,0 +1,466 @@
+package extract
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// heading is a top-level ATX or setext heading. A setext heading spans its
+// paragraph lines and underline, first through last.
+type heading struct {
+	first, last int
+	level       int
+	text        string
+}
+
+type leafKind int
+
+const (
+	leafNone leafKind = iota
+	leafParagraph
+	leafFenced
+	leafIndented
+	leafHTML
+)
+
+// container is an open block quote or list item.
+type container struct {
+	quote bool
+	// width is how far a list item's content is indented past the column
+	// where the item starts; later lines must be indented that far to stay in it.
+	width int
+	// empty is set while a list item has no content; a blank line then ends it.
+	empty bool
+}
+
+// blockScanner follows CommonMark block structure a line at a time, tracking
+// just enough of it to tell which lines are top-level headings: headings in
+// block quotes, list items, code blocks and HTML blocks do not count. Link
+// reference definitions are treated as paragraph text.
+type blockScanner struct {
+	open []container
+	leaf leafKind
+
+	fenceChar byte
+	fenceLen  int
+	htmlCond  int
+
+	paraFirst int
+	paraTop   bool
+	paraText  []string
+
+	headings []heading
+}
+
+// scanHeadings returns the top-level headings in lines, in order.
+func scanHeadings(lines []string) []heading {
+	var b blockScanner
+	for i, raw := range lines {
+		b.scan(i, strings.TrimSuffix(raw, "\r"))
+	}
+	return b.headings
+}
+
+func (b *blockScanner) scan(i int, raw string) {
+	line := expandTabs(raw)
+	pos := 0
+	defer func() {
+		if !isBlank(line[pos:]) {
+			for k := range b.open {
+				b.open[k].empty = false
+			}
+		}
+	}()
+
+	matched := 0
+	for _, c := range b.open {
+		rest := line[pos:]
+		n := leadingSpaces(rest)
+		if c.quote {
+			if n > 3 || n == len(rest) || rest[n] != '>' {
+				break
+			}
+			pos += n + 1
+			if pos < len(line) && line[pos] == ' ' {
+				pos++
+			}
+		} else if isBlank(rest) {
+			if c.empty {
+				break
+			}
+		} else if n >= c.width {
+			pos += c.width
+		} else {
+			break
+		}
+		matched++
+	}
+	reached := matched == len(b.open)
+
+	if reached {
+		rest := line[pos:]
+		switch b.leaf {
+		case leafFenced:
+			if fenceCloses(rest, b.fenceChar, b.fenceLen) {
+				b.leaf = leafNone
+			}
+			return
+		case leafHTML:
+			if b.htmlCond >= 6 && isBlank(rest) || htmlBlockEnds(b.htmlCond, rest) {
+				b.leaf = leafNone
+			}
+			return
+		case leafIndented:
+			if isBlank(rest) || leadingSpaces(rest) >= 4 {
+				return
+			}
+			b.leaf = leafNone
+		}
+	}
+
+	maybeLazy := b.leaf == leafParagraph
+	paraOpen := maybeLazy && reached
+	started := false
+	// start closes the containers this line did not continue, and the open
+	// leaf block, before a new block opens.
+	start := func() {
+		if !started {
+			b.open = b.open[:matched]
+			started = true
+		}
+		b.leaf = leafNone
+	}
+
+	for {
+		rest := line[pos:]
+		indent := leadingSpaces(rest)
+		if indent >= 4 {
+			if !maybeLazy && !isBlank(rest) {
+				start()
+				b.leaf = leafIndented
+				return
+			}
+			break
+		}
+		s := rest[indent:]
+
+		if s != "" && s[0] == '>' {
+			start()
+			pos += indent + 1
+			if pos < len(line) && line[pos] == ' ' {
+				pos++
+			}
+			b.open = append(b.open, container{quote: true})
+			maybeLazy, paraOpen = false, false
+			continue
+		}
+		if level, _ := atxHeading(s); level > 0 {
+			start()
+			if len(b.open) == 0 {
+				_, text := atxHeading(strings.TrimLeft(raw, " "))
+				b.headings = append(b.headings, heading{first: i, last: i, level: level, text: text})
+			}
+			return
+		}
+		if char, n, ok := fenceOpens(s); ok {
+			start()
+			b.leaf, b.fenceChar, b.fenceLen = leafFenced, char, n
+			return
+		}
+		if cond := htmlBlockStart(s); cond > 0 && !(cond == 7 && paraOpen) {
+			start()
+			if !htmlBlockEnds(cond, s) {
+				b.leaf, b.htmlCond = leafHTML, cond
+			}
+			return
+		}
+		if level := setextLevel(s); paraOpen && level > 0 {
+			if b.paraTop {
+				b.headings = append(b.headings, heading{first: b.paraFirst, last: i, level: level, text: strings.Join(b.paraText, " ")})
+			}
+			start()
+			return
+		}
+		if thematicBreak(s) {
+			start()
+			return
+		}
+		if consumed, width, ok := listItemStart(s, paraOpen); ok {
+			start()
+			pos += indent + consumed
+			b.open = append(b.open, container{width: indent + width, empty: true})
+			maybeLazy, paraOpen = false, false
+			continue
+		}
+		break
+	}
+
+	rest := line[pos:]
+	if !started && maybeLazy && !isBlank(rest) {
+		// A paragraph continuation line, lazy when containers were not matched.
+		if b.paraTop {
+			b.paraText = append(b.paraText, strings.TrimSpace(raw))
+		}
+		return
+	}
+	start()
+	if isBlank(rest) {
+		return
+	}
+	b.leaf = leafParagraph
+	b.paraFirst = i
+	b.paraTop = len(b.open) == 0
+	b.paraText = []string{strings.TrimSpace(raw)}
+}
+
+// atxHeading returns the level and text of an ATX heading, with any closing
+// sequence of '#' removed, or 0 when s (without indentation) is not one.
+func atxHeading(s string) (int, string) {
+	level := 0
+	for level < len(s) && s[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 || level < len(s) && s[level] != ' ' && s[level] != '\t' {
+		return 0, ""
+	}
+	text := strings.Trim(s[level:], " \t")
+	closed := strings.TrimRight(text, "#")
+	switch {
+	case closed == "":
+		text = ""
+	case closed[len(closed)-1] == ' ' || closed[len(closed)-1] == '\t':
+		text = strings.TrimRight(closed, " \t")
+	}
+	return level, text
+}
+
+// setextLevel returns 1 for an "=" underline, 2 for a "-" one, or 0.
+func setextLevel(s string) int {
+	s = strings.TrimRight(s, " \t")
+	switch {
+	case s == "":
+		return 0
+	case strings.Trim(s, "=") == "":
+		return 1
+	case strings.Trim(s, "-") == "":
+		return 2
+	}
+	return 0
+}
+
+// thematicBreak reports whether s is three or more matching '*', '-' or '_',
+// optionally separated by spaces or tabs.
+func thematicBreak(s string) bool {
+	if s == "" || strings.IndexByte("*-_", s[0]) < 0 {
+		return false
+	}
+	count := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case s[0]:
+			count++
+		case ' ', '\t':
+		default:
+			return false
+		}
+	}
+	return count >= 3
+}
+
+// fenceOpens returns the character and length of a code fence opening s.
+// A backtick fence's info string may not contain backticks.
+func fenceOpens(s string) (byte, int, bool) {
+	if s == "" || s[0] != '`' && s[0] != '~' {
+		return 0, 0, false
+	}
+	n := 0
+	for n < len(s) && s[n] == s[0] {
+		n++
+	}
+	if n < 3 || s[0] == '`' && strings.Contains(s[n:], "`") {
+		return 0, 0, false
+	}
+	return s[0], n, true
+}
+
+// fenceCloses reports whether line closes a fence opened with n chars: at
+// most three spaces of indentation, then at least n of them and nothing else.
+func fenceCloses(line string, char byte, n int) bool {
+	indent := leadingSpaces(line)
+	if indent > 3 {
+		return false
+	}
+	s := line[indent:]
+	run := 0
+	for run < len(s) && s[run] == char {
+		run++
+	}
+	return run >= n && isBlank(s[run:])
+}
+
+// listItemStart parses a list marker at the start of s. It returns how many
+// bytes of s the marker and its following spaces take, and the column the
+// item's content starts at. Only a non-empty bullet or an item numbered 1 may
+// interrupt a paragraph.
+func listItemStart(s string, interrupt bool) (consumed, width int, ok bool) {
+	n := 0
+	if s != "" && strings.IndexByte("-+*", s[0]) >= 0 {
+		n = 1
+	} else {
+		for n < len(s) && n < 9 && s[n] >= '0' && s[n] <= '9' {
+			n++
+		}
+		if n == 0 || n == len(s) || s[n] != '.' && s[n] != ')' {
+			return 0, 0, false
+		}
+		if number, _ := strconv.Atoi(s[:n]); interrupt && number != 1 {
+			return 0, 0, false
+		}
+		n++
+	}
+
+	rest := s[n:]
+	switch spaces := leadingSpaces(rest); {
+	case rest != "" && spaces == 0:
+		return 0, 0, false
+	case isBlank(rest):
+		if interrupt {
+			return 0, 0, false
+		}
+		return n, n + 1, true
+	case spaces >= 5:
+		// The content is an indented code block one space past the marker.
+		return n + 1, n + 1, true
+	default:
+		return n + spaces, n + spaces, true
+	}
+}
+
+// htmlBlockTags are the tag names of HTML block start condition 6.
+var htmlBlockTags = map[string]bool{
+	"address": true, "article": true, "aside": true, "base": true, "basefont": true,
+	"blockquote": true, "body": true, "caption": true, "center": true, "col": true,
+	"colgroup": true, "dd": true, "details": true, "dialog": true, "dir": true,
+	"div": true, "dl": true, "dt": true, "fieldset": true, "figcaption": true,
+	"figure": true, "footer": true, "form": true, "frame": true, "frameset": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"head": true, "header": true, "hr": true, "html": true, "iframe": true,
+	"legend": true, "li": true, "link": true, "main": true, "menu": true,
+	"menuitem": true, "nav": true, "noframes": true, "ol": true, "optgroup": true,
+	"option": true, "p": true, "param": true, "search": true, "section": true,
+	"summary": true, "table": true, "tbody": true, "td": true, "tfoot": true,
+	"th": true, "thead": true, "title": true, "tr": true, "track": true, "ul": true,
+}
+
+// htmlRawTags start HTML blocks (condition 1) that run to their closing tag.
+var htmlRawTags = []string{"pre", "script", "style", "textarea"}
+
+// htmlTagLine matches a line holding only a complete open or closing tag
+// (condition 7).
+var htmlTagLine = regexp.MustCompile(`^(?:<[A-Za-z][A-Za-z0-9-]*` +
+	`(?:[ \t]+[A-Za-z_:][A-Za-z0-9_.:-]*(?:[ \t]*=[ \t]*(?:[^ \t"'=<>` + "`" + `]+|'[^']*'|"[^"]*"))?)*` +
+	`[ \t]*/?>|</[A-Za-z][A-Za-z0-9-]*[ \t]*>)[ \t]*$`)
+
+// htmlBlockStart returns the CommonMark start condition (1-7) of an HTML
+// block opening s, or 0.
+func htmlBlockStart(s string) int {
+	if !strings.HasPrefix(s, "<") {
+		return 0
+	}
+	lower := strings.ToLower(s)
+	for _, tag := range htmlRawTags {
+		if rest, ok := strings.CutPrefix(lower, "<"+tag); ok && (rest == "" || strings.IndexByte(" \t>", rest[0]) >= 0) {
+			return 1
+		}
+	}
+	switch {
+	case strings.HasPrefix(s, "<!--"):
+		return 2
+	case strings.HasPrefix(s, "<?"):
+		return 3
+	case strings.HasPrefix(s, "<![CDATA["):
+		return 5
+	case len(s) > 2 && s[1] == '!' && isASCIILetter(s[2]):
+		return 4
+	}
+
+	name := strings.TrimPrefix(lower[1:], "/")
+	end := 0
+	for end < len(name) && (isASCIILetter(name[end]) || name[end] >= '0' && name[end] <= '9') {
+		end++
+	}
+	if rest := name[end:]; htmlBlockTags[name[:end]] &&
+		(rest == "" || rest[0] == ' ' || rest[0] == '\t' || rest[0] == '>' || strings.HasPrefix(rest, "/>")) {
+		return 6
+	}
+	for _, tag := range htmlRawTags {
+		if name[:end] == tag {
+			return 0
+		}
+	}
+	if htmlTagLine.MatchString(s) {
+		return 7
+	}
+	return 0
+}
+
+// htmlBlockEnds reports whether line holds the end of an HTML block with
+// start condition 1-5; blocks 6 and 7 end at a blank line instead.
+func htmlBlockEnds(cond int, line string) bool {
+	switch cond {
+	case 1:
+		lower := strings.ToLower(line)
+		for _, tag := range htmlRawTags {
+			if strings.Contains(lower, "</"+tag+">") {
+				return true
+			}
+		}
+	case 2:
+		return strings.Contains(line, "-->")
+	case 3:
+		return strings.Contains(line, "?>")
+	case 4:
+		return strings.Contains(line, ">")
+	case 5:
+		return strings.Contains(line, "]]>")
+	}
+	return false
+}
+
+func isASCIILetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// expandTabs replaces tabs with spaces to the next multiple of four columns,
+// so indentation can be measured in bytes.
+func expandTabs(s string) string {
+	if !strings.Contains(s, "\t") {
+		return s
+	}
+	var b strings.Builder
+	col := 0
+	for _, r := range s {
+		if r == '\t' {
+			n := 4 - col%4
+			b.WriteString(strings.Repeat(" ", n))
+			col += n
+			continue
+		}
+		b.WriteRune(r)
+		col++
+	}
+	return b.String()
+}
+
+func leadingSpaces(s string) int {
+	n := 0
+	for n < len(s) && s[n] == ' ' {
+		n++
+	}
+	return n
+}
+
+func isBlank(s string) bool {
+	return strings.Trim(s, " \t") == ""
+}
@@ -0,0 +1,62 @@
+package extract
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// commonMarkExample is a CommonMark spec example, or a variation of one, with
+// the top-level headings it should produce as "h<level> <text>".
+type commonMarkExample struct {
+	Section  string   `json:"section"`
+	Markdown string   `json:"markdown"`
+	Headings []string `json:"headings"`
+}
+
+func TestCommonMarkConformance(t *testing.T) {
+	raw, err := os.ReadFile(filepath.Join("testdata", "commonmark.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var examples []commonMarkExample
+	if err := json.Unmarshal(raw, &examples); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, example := range examples {
+		var got []string
+		for _, s := range ExtractLevels(example.Markdown, Levels{Min: 1, Max: 6}) {
+			if s.Level > 0 {
+				got = append(got, strings.TrimSpace(fmt.Sprintf("h%d %s", s.Level, s.Heading)))
+			}
+		}
+		if !slices.Equal(got, example.Headings) {
+			t.Errorf("%s example %d %q: headings = %q, want %q", example.Section, i+1, example.Markdown, got, example.Headings)
+		}
+	}
+}
+
+func TestExtractLevelsSetextHeadingSpansItsLines(t *testing.T) {
+	doc := "Top\n===\na\n\nSub\nwraps\n---\nb"
+
+	sections := ExtractLevels(doc, Levels{Min: 1, Max: 2})
+	var got []string
+	for _, s := range sections {
+		got = append(got, fmt.Sprintf("%s:L%d:%d-%d:%q", s.Heading, s.Level, s.StartLine, s.EndLine, s.Body))
+	}
+	want := []string{
+		`Top:L1:1-4:"a\n"`,
+		`Sub wraps:L2:5-8:"b"`,
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("sections = %v, want %v", got, want)
+	}
+	if total := Tree(sections)[0].TotalLines(); total != 2+(3+1) {
+		t.Fatalf("Top should count Sub's three heading lines, got %d", total)
+	}
+}
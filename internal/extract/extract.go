@@ -5,69 +5,199 @@ import (
 	"strings"
 )
 
-// Section is a markdown slice rooted at a top-level (##) heading.
+// Section is a markdown slice rooted at a heading.
 type Section struct {
-	ID        int
-	Heading   string
-	Body      string
-	LineCount int
+	ID      int
+	Heading string
+	// Level is the heading level (1-6), or 0 for the preamble.
+	Level int
+	// Parent is the ID of the section whose heading encloses this one, or 0.
+	Parent int
+	// Slug is the heading's GitHub-style anchor, unique within the document;
+	// empty for the preamble.
+	Slug string
+	// StableID names the section by its heading path ("auth/token-rotation"),
+	// with "~2", "~3" for repeats of a path, so it survives edits elsewhere
+	// in the document.
+	StableID string
+	// ContentHash identifies the heading and body text.
+	ContentHash string
+	Body        string
+	LineCount   int
+	// StartLine and EndLine are the 1-based, inclusive lines the section spans
+	// in the original file, heading included; frontmatter is counted.
+	StartLine int
+	EndLine   int
+	// StartByte and EndByte are the section's byte offsets in the original
+	// file; EndByte is exclusive and excludes the final newline.
+	StartByte int
+	EndByte   int
+
+	// headingLines is how many lines the heading takes: more than one for a
+	// setext heading whose text wraps, and 0 (meaning 1) when not set.
+	headingLines int
+}
+
+// Levels selects the heading levels that start a section; deeper and
+// shallower headings stay in the body.
+type Levels struct {
+	Min int
+	Max int
+}
+
+// DefaultLevels splits on "## " headings only.
+func DefaultLevels() Levels {
+	return Levels{Min: 2, Max: 2}
 }
 
-// ExtractSections splits a markdown document into sections by "## " headings.
-// It ignores headings inside fenced code blocks and skips YAML frontmatter.
+// Validate checks that 1 <= Min <= Max <= 6.
+func (l Levels) Validate() error {
+	if l.Min < 1 || l.Max > 6 || l.Min > l.Max {
+		return fmt.Errorf("heading levels %d-%d must satisfy 1 <= min <= max <= 6", l.Min, l.Max)
+	}
+	return nil
+}
+
+// ExtractSections splits a markdown document into sections by level-2
+// headings. It skips YAML frontmatter and follows CommonMark block structure,
+// so ATX ("## Title") and setext ("Title" over "---") headings count, while
+// lines in code blocks, HTML blocks, block quotes and list items do not.
 func ExtractSections(doc string) []Section {
-	lines := splitLines(doc)
-	lines = skipYAMLFrontmatter(lines)
+	return ExtractLevels(doc, DefaultLevels())
+}
+
+// ExtractLevels splits a markdown document at every heading within levels, in
+// document order. Each section's body runs to the next such heading, so a
+// section's subsections are not part of its body; Parent links them instead.
+func ExtractLevels(doc string, levels Levels) []Section {
+	all := splitLines(doc)
+	lines := skipYAMLFrontmatter(all)
+	skipped := len(all) - len(lines)
+
+	offsets := make([]int, len(all))
+	offset := 0
+	for i, line := range all {
+		offsets[i] = offset
+		offset += len(line) + 1
+	}
+	// A trailing newline leaves an empty last element that is not a line.
+	lastLine := len(all) - 1
+	if lastLine > 0 && all[lastLine] == "" {
+		lastLine--
+	}
 
 	sections := make([]Section, 0)
 	nextID := 1
 
-	currentHeading := "Preamble"
+	current := Section{Heading: "Preamble"}
+	start := skipped
 	currentBody := make([]string, 0)
 	hasSeenHeading := false
-	inFence := false
-	fence := ""
+	// open holds the enclosing headings of the current position, outermost first.
+	var open []Section
+	// Anchors count every heading, including levels that do not start a section.
+	slugs := slugger{}
 
-	emit := func(heading string, bodyLines []string, isPreamble bool) {
+	// emit closes section, which spans lines start through end (indexes into all).
+	emit := func(section Section, bodyLines []string, isPreamble bool, end int) {
 		body := strings.Join(bodyLines, "\n")
 		if isPreamble && strings.TrimSpace(body) == "" {
 			return
 		}
-		sections = append(sections, Section{
-			ID:        nextID,
-			Heading:   heading,
-			Body:      body,
-			LineCount: len(bodyLines),
-		})
+		end = max(min(end, lastLine), start)
+		section.StartLine = start + 1
+		section.EndLine = end + 1
+		section.StartByte = offsets[start]
+		section.EndByte = offsets[end] + len(all[end])
+		section.ID = nextID
+		section.Body = body
+		section.LineCount = len(bodyLines)
+		sections = append(sections, section)
 		nextID++
 	}
 
-	for _, line := range lines {
-		trimmedLeft := strings.TrimLeft(line, " \t")
-
-		if !inFence && strings.HasPrefix(trimmedLeft, "## ") {
-			emit(currentHeading, currentBody, !hasSeenHeading)
-			hasSeenHeading = true
-			currentHeading = strings.TrimSpace(strings.TrimPrefix(trimmedLeft, "## "))
-			currentBody = make([]string, 0)
-			continue
+	headings := scanHeadings(lines)
+	for i := 0; i < len(lines); i++ {
+		if len(headings) > 0 && headings[0].first == i {
+			h := headings[0]
+			headings = headings[1:]
+			slug := slugs.next(h.text)
+			if h.level >= levels.Min && h.level <= levels.Max {
+				emit(current, currentBody, !hasSeenHeading, skipped+i-1)
+				if hasSeenHeading {
+					current.ID = nextID - 1
+					open = append(open, current)
+				}
+				hasSeenHeading = true
+				for len(open) > 0 && open[len(open)-1].Level >= h.level {
+					open = open[:len(open)-1]
+				}
+				current = Section{Heading: h.text, Level: h.level, Slug: slug, headingLines: h.last - h.first + 1}
+				if len(open) > 0 {
+					current.Parent = open[len(open)-1].ID
+				}
+				currentBody = make([]string, 0)
+				start = skipped + i
+				i = h.last
+				continue
+			}
 		}
+		currentBody = append(currentBody, lines[i])
+	}
 
-		currentBody = append(currentBody, line)
+	if len(lines) > 0 {
+		emit(current, currentBody, !hasSeenHeading, len(all)-1)
+	}
+	assignStableIDs(sections)
+	return sections
+}
 
-		if marker := fenceMarker(trimmedLeft); marker != "" {
-			if !inFence {
-				inFence = true
-				fence = marker
-			} else if marker == fence {
-				inFence = false
-				fence = ""
-			}
+// Node is a section with the subsections nested under it.
+type Node struct {
+	Section
+	Children []Node
+}
+
+// TotalLines counts the node's own lines, its descendants' lines and their
+// heading lines.
+func (n Node) TotalLines() int {
+	total := n.LineCount
+	for _, child := range n.Children {
+		total += max(child.headingLines, 1) + child.TotalLines()
+	}
+	return total
+}
+
+// TreeEndLine is the last line of the node's deepest last descendant, so
+// StartLine through TreeEndLine spans the node with all its subsections.
+func (n Node) TreeEndLine() int {
+	if len(n.Children) == 0 {
+		return n.EndLine
+	}
+	return n.Children[len(n.Children)-1].TreeEndLine()
+}
+
+// Tree nests sections from ExtractLevels under their parents.
+func Tree(sections []Section) []Node {
+	children := make(map[int][]Section)
+	var roots []Section
+	for _, section := range sections {
+		if section.Parent == 0 {
+			roots = append(roots, section)
+		} else {
+			children[section.Parent] = append(children[section.Parent], section)
 		}
 	}
 
-	emit(currentHeading, currentBody, !hasSeenHeading)
-	return sections
+	var build func([]Section) []Node
+	build = func(sections []Section) []Node {
+		nodes := make([]Node, 0, len(sections))
+		for _, section := range sections {
+			nodes = append(nodes, Node{Section: section, Children: build(children[section.ID])})
+		}
+		return nodes
+	}
+	return build(roots)
 }
 
 // Preview returns an adaptive section preview.
@@ -154,4 +284,3 @@ func truncateRunes(s string, max int) string {
 	}
 	return string(r[:max])
 }
-
@@ -114,3 +114,95 @@ func joinNumberedLines(prefix string, n int) string {
 	}
 	return strings.Join(lines, "\n")
 }
+
+func TestExtractLevelsNestsSubsections(t *testing.T) {
+	doc := "# Plan\nintro\n## A\nalpha\n### A.1\none\n```\n### fenced\n```\n#### A.1.a\ndeep\n### A.2\ntwo\n## B\nbeta"
+
+	sections := ExtractLevels(doc, Levels{Min: 2, Max: 3})
+	var got []string
+	for _, s := range sections {
+		got = append(got, fmt.Sprintf("%d:%s:L%d:P%d:%d", s.ID, s.Heading, s.Level, s.Parent, s.LineCount))
+	}
+	want := []string{
+		"1:Preamble:L0:P0:2",
+		"2:A:L2:P0:1",
+		"3:A.1:L3:P2:6",
+		"4:A.2:L3:P2:1",
+		"5:B:L2:P0:1",
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("sections = %v, want %v", got, want)
+	}
+
+	tree := Tree(sections)
+	if len(tree) != 3 || len(tree[1].Children) != 2 || tree[1].Children[1].Heading != "A.2" {
+		t.Fatalf("unexpected tree %+v", tree)
+	}
+	if total := tree[1].TotalLines(); total != 1+(1+6)+(1+1) {
+		t.Fatalf("A should total its own and its subsections' lines, got %d", total)
+	}
+	if a := tree[1]; a.TreeEndLine()-a.StartLine != a.TotalLines() {
+		t.Fatalf("A spans lines %d-%d but totals %d lines", a.StartLine, a.TreeEndLine(), a.TotalLines())
+	}
+}
+
+func TestExtractLevelsSkippedLevelsAttachToNearestAncestor(t *testing.T) {
+	doc := "# Top\n### Deep\nx\n## Mid\n#### Deeper\ny"
+
+	sections := ExtractLevels(doc, Levels{Min: 1, Max: 6})
+	parents := map[string]int{}
+	for _, s := range sections {
+		parents[s.Heading] = s.Parent
+	}
+	if parents["Top"] != 0 || parents["Deep"] != 1 || parents["Mid"] != 1 || parents["Deeper"] != 3 {
+		t.Fatalf("unexpected parents %v", parents)
+	}
+}
+
+func TestExtractSectionsMatchesDefaultLevels(t *testing.T) {
+	doc := "# Title\nintro\n## A\n### A.1\nalpha\n## B\nbeta"
+
+	sections := ExtractSections(doc)
+	if len(sections) != 3 || sections[1].Level != 2 || !strings.Contains(sections[1].Body, "### A.1") {
+		t.Fatalf("default extraction should keep ### headings in the body, got %+v", sections)
+	}
+}
+
+func TestLevelsValidate(t *testing.T) {
+	for _, levels := range []Levels{{0, 2}, {3, 2}, {2, 7}} {
+		if levels.Validate() == nil {
+			t.Errorf("expected %v to be rejected", levels)
+		}
+	}
+	if err := (Levels{Min: 1, Max: 6}).Validate(); err != nil {
+		t.Fatalf("h1-h6 should be valid: %v", err)
+	}
+}
+
+func TestExtractSectionsRecordsSourceRanges(t *testing.T) {
+	doc := "---\ntitle: x\n---\nintro\n## A\nalpha\n\n## B\n## C\ngamma\n"
+
+	sections := ExtractSections(doc)
+	var got []string
+	for _, s := range sections {
+		got = append(got, fmt.Sprintf("%s:%d-%d:%q", s.Heading, s.StartLine, s.EndLine, doc[s.StartByte:s.EndByte]))
+	}
+	want := []string{
+		`Preamble:4-4:"intro"`,
+		`A:5-7:"## A\nalpha\n"`,
+		`B:8-8:"## B"`,
+		`C:9-10:"## C\ngamma"`,
+	}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("ranges = %v, want %v", got, want)
+	}
+}
+
+func TestExtractLevelsRangesExcludeSubsections(t *testing.T) {
+	doc := "## A\nalpha\n### A.1\none\n## B"
+
+	sections := ExtractLevels(doc, Levels{Min: 2, Max: 3})
+	if sections[0].EndLine != 2 || sections[1].StartLine != 3 || sections[1].EndLine != 4 || sections[2].StartLine != 5 {
+		t.Fatalf("unexpected ranges %+v", sections)
+	}
+}
@@ -0,0 +1,172 @@
+package extract
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// condensedLines is how many lines of a section's opening paragraph Condensed keeps.
+const condensedLines = 3
+
+// Slug returns the GitHub-style anchor for a heading: lowercased, with
+// punctuation other than hyphens and underscores removed and spaces turned
+// into hyphens. It does not disambiguate repeated headings; see slugger.
+func Slug(heading string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(heading)) {
+		switch {
+		case r == ' ':
+			b.WriteRune('-')
+		case r == '-' || unicode.IsLetter(r) || unicode.IsMark(r) || unicode.IsNumber(r) || unicode.Is(unicode.Pc, r):
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// slugger hands out document-unique anchors the way GitHub does: the second
+// "Setup" heading becomes setup-1, the third setup-2.
+type slugger map[string]int
+
+func (s slugger) next(heading string) string {
+	base := Slug(heading)
+	slug := base
+	for {
+		if _, taken := s[slug]; !taken {
+			break
+		}
+		s[base]++
+		slug = fmt.Sprintf("%s-%d", base, s[base])
+	}
+	s[slug] = 0
+	return slug
+}
+
+// assignStableIDs sets StableID and ContentHash. Sections must be in document
+// order, so parents precede their subsections.
+func assignStableIDs(sections []Section) {
+	paths := make(map[int]string, len(sections))
+	seen := make(map[string]int, len(sections))
+	for i := range sections {
+		section := &sections[i]
+		base := Slug(section.Heading)
+		switch {
+		case section.Level == 0:
+			base = "preamble"
+		case base == "":
+			base = "section"
+		}
+		path := base
+		if parent, ok := paths[section.Parent]; ok {
+			path = parent + "/" + base
+		}
+		seen[path]++
+		if n := seen[path]; n > 1 {
+			path = fmt.Sprintf("%s~%d", path, n)
+		}
+		paths[section.ID] = path
+		section.StableID = path
+
+		h := sha256.Sum256([]byte(section.Heading + "\n" + section.Body))
+		section.ContentHash = hex.EncodeToString(h[:])[:16]
+	}
+}
+
+// Lookup finds the section ref names: a section ID, a stable ID, an exact
+// heading, a heading anchor slug (with or without the leading "#"), or a
+// content hash (or a prefix of at least 8 characters), tried in that order,
+// so a number that is no section's ID can still name a heading like "2024".
+// A heading shared by several sections is ambiguous.
+func Lookup(sections []Section, ref string) (Section, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return Section{}, fmt.Errorf("empty section reference")
+	}
+	id, err := strconv.Atoi(ref)
+	if err == nil {
+		for _, section := range sections {
+			if section.ID == id {
+				return section, nil
+			}
+		}
+	}
+	for _, section := range sections {
+		if section.StableID == ref {
+			return section, nil
+		}
+	}
+
+	var matches []Section
+	for _, section := range sections {
+		if section.Heading == ref {
+			matches = append(matches, section)
+		}
+	}
+	switch len(matches) {
+	case 1:
+		return matches[0], nil
+	case 0:
+	default:
+		ids := make([]string, 0, len(matches))
+		for _, section := range matches {
+			ids = append(ids, strconv.Itoa(section.ID))
+		}
+		return Section{}, fmt.Errorf("heading %q matches sections %s; use an ID or slug", ref, strings.Join(ids, ", "))
+	}
+
+	slug := strings.ToLower(strings.TrimPrefix(ref, "#"))
+	for _, section := range sections {
+		if section.Slug != "" && section.Slug == slug {
+			return section, nil
+		}
+	}
+	if len(ref) >= 8 {
+		for _, section := range sections {
+			if strings.HasPrefix(section.ContentHash, strings.ToLower(ref)) {
+				return section, nil
+			}
+		}
+	}
+	if err == nil {
+		return Section{}, fmt.Errorf("no section with ID %d", id)
+	}
+	return Section{}, fmt.Errorf("no section with stable ID, heading, slug or content hash %q", ref)
+}
+
+// Condensed returns the opening paragraph of the section body, at most
+// condensedLines lines, with a marker counting the lines left out.
+func (s Section) Condensed() string {
+	lines := splitBodyLines(s.Body)
+	var kept []string
+	started := false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if !started && trimmed == "" {
+			continue
+		}
+		if trimmed == "" || fenceMarker(trimmed) != "" || len(kept) == condensedLines {
+			break
+		}
+		started = true
+		kept = append(kept, trimmed)
+	}
+
+	nonBlank := 0
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			nonBlank++
+		}
+	}
+	if omitted := nonBlank - len(kept); omitted > 0 {
+		unit := "lines"
+		if omitted == 1 {
+			unit = "line"
+		}
+		kept = append(kept, fmt.Sprintf("[... %d more %s ...]", omitted, unit))
+	}
+	return strings.Join(kept, "\n")
+}
@@ -0,0 +1,128 @@
+package extract
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSlug(t *testing.T) {
+	for heading, want := range map[string]string{
+		"Threat Model":             "threat-model",
+		"API v2: Auth & Tokens!":   "api-v2-auth--tokens",
+		"snake_case and-hyphens":   "snake_case-and-hyphens",
+		"`ExtractSections` (flat)": "extractsections-flat",
+		"Überprüfung der Latenz":   "überprüfung-der-latenz",
+	} {
+		if got := Slug(heading); got != want {
+			t.Errorf("Slug(%q) = %q, want %q", heading, got, want)
+		}
+	}
+}
+
+func TestExtractSectionsDisambiguatesSlugs(t *testing.T) {
+	doc := "## Setup\na\n### Setup\nb\n## Setup\nc\n## Setup 1\nd"
+
+	sections := ExtractSections(doc)
+	var got []string
+	for _, s := range sections {
+		got = append(got, s.Slug)
+	}
+	// The ### heading is not a section but still takes setup-1, as on GitHub.
+	if want := "setup setup-2 setup-1-1"; strings.Join(got, " ") != want {
+		t.Fatalf("slugs = %q, want %q", got, want)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	sections := ExtractSections("intro\n## Threat Model\na\n## Rollout\nb\n## Rollout\nc")
+
+	for ref, wantID := range map[string]int{
+		"2":                         2,
+		"Threat Model":              2,
+		"threat-model":              2,
+		"#threat-model":             2,
+		"rollout-1":                 4,
+		"rollout~2":                 4,
+		"preamble":                  1,
+		"1":                         1,
+		sections[2].ContentHash[:8]: 3,
+	} {
+		section, err := Lookup(sections, ref)
+		if err != nil || section.ID != wantID {
+			t.Errorf("Lookup(%q) = %d, %v; want %d", ref, section.ID, err, wantID)
+		}
+	}
+
+	for ref, fragment := range map[string]string{
+		"9":       "no section with ID 9",
+		"Rollout": "matches sections 3, 4",
+		"Threat":  "no section with stable ID, heading, slug or content hash",
+		"  ":      "empty section reference",
+	} {
+		if _, err := Lookup(sections, ref); err == nil || !strings.Contains(err.Error(), fragment) {
+			t.Errorf("Lookup(%q) error = %v, want %q", ref, err, fragment)
+		}
+	}
+}
+
+func TestLookupNumericHeading(t *testing.T) {
+	sections := ExtractSections("## Plan\na\n## 2024\nb\n## 2025\nc")
+
+	for ref, wantID := range map[string]int{
+		"2":    2,
+		"2024": 2,
+		"2025": 3,
+	} {
+		section, err := Lookup(sections, ref)
+		if err != nil || section.ID != wantID {
+			t.Errorf("Lookup(%q) = %d, %v; want %d", ref, section.ID, err, wantID)
+		}
+	}
+	if _, err := Lookup(sections, "2026"); err == nil || !strings.Contains(err.Error(), "no section with ID 2026") {
+		t.Errorf("Lookup(2026) error = %v", err)
+	}
+}
+
+func TestStableIDsSurviveEdits(t *testing.T) {
+	before := ExtractLevels("## Auth\na\n### Tokens\nb\n## Rollout\nc\n## Rollout\nd", Levels{Min: 2, Max: 3})
+	after := ExtractLevels("intro\n## Scope\nnew\n## Auth\na\n### Tokens\nb\n## Rollout\nc\n## Rollout\nd", Levels{Min: 2, Max: 3})
+
+	var got []string
+	for _, s := range before {
+		got = append(got, s.StableID)
+	}
+	if want := "auth auth/tokens rollout rollout~2"; strings.Join(got, " ") != want {
+		t.Fatalf("stable IDs = %q, want %q", got, want)
+	}
+
+	byStableID := make(map[string]Section)
+	for _, s := range after {
+		byStableID[s.StableID] = s
+	}
+	for _, s := range before {
+		moved, ok := byStableID[s.StableID]
+		if !ok {
+			t.Fatalf("stable ID %q lost after inserting sections", s.StableID)
+		}
+		if moved.ID == s.ID {
+			t.Fatalf("section %q kept ID %d; the test should renumber it", s.StableID, s.ID)
+		}
+		if moved.ContentHash != s.ContentHash {
+			t.Fatalf("content hash of %q changed: %s -> %s", s.StableID, s.ContentHash, moved.ContentHash)
+		}
+	}
+	if before[2].ContentHash == before[3].ContentHash {
+		t.Fatal("sections with different bodies share a content hash")
+	}
+}
+
+func TestCondensed(t *testing.T) {
+	section := Section{Body: "\nFirst line.\nSecond line.\nThird line.\nFourth line.\n\nMore text.\n```\ncode\n```"}
+	want := "First line.\nSecond line.\nThird line.\n[... 5 more lines ...]"
+	if got := section.Condensed(); got != want {
+		t.Fatalf("Condensed() = %q, want %q", got, want)
+	}
+	if got := (Section{Body: "Only line."}).Condensed(); got != "Only line." {
+		t.Fatalf("short section should be returned whole, got %q", got)
+	}
+}
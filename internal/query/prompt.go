@@ -2,6 +2,7 @@ package query
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
@@ -43,7 +44,15 @@ func BuildPrompt(question string, files map[string]string, mode string) string {
 		b.WriteString("Answer based on the file content below. Cite specific lines as path:N.\n\n")
 	}
 
-	for path, content := range files {
+	// Sorted so identical inputs always produce identical prompts (cache and replay keys).
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		content := files[path]
 		lines := strings.Split(content, "\n")
 		totalLines := len(lines)
 
@@ -4,22 +4,28 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"strings"
+
+	"github.com/mistakeknot/interserve/internal/dispatch"
 )
 
 // QueryResult is the MCP-facing response payload for codex_query.
 type QueryResult struct {
-	Status         string   `json:"status"`
-	Answer         string   `json:"answer"`
-	FilesAnalyzed  []string `json:"files_analyzed"`
-	LineCountSaved int      `json:"line_count_saved"`
-	Mode           string   `json:"mode"`
-	Error          string   `json:"error,omitempty"`
+	Status               string         `json:"status"`
+	Answer               string         `json:"answer"`
+	FilesAnalyzed        []string       `json:"files_analyzed"`
+	LineCountSaved       int            `json:"line_count_saved"`
+	Mode                 string         `json:"mode"`
+	Backend              string         `json:"backend,omitempty"`
+	QueueWaitMs          int64          `json:"queue_wait_ms"`
+	EstimatedTokensSaved int            `json:"estimated_tokens_saved"`
+	Usage                dispatch.Usage `json:"usage"`
+	RetryAfterMs         int64          `json:"retry_after_ms,omitempty"`
+	Error                string         `json:"error,omitempty"`
 }
 
-// Query reads the given files, sends them to Codex via dispatch.sh, and returns a compact answer.
-func Query(ctx context.Context, dispatchPath string, question string, files []string, mode string) QueryResult {
+// Query reads the given files, sends them to Codex via the dispatcher, and returns a compact answer.
+func Query(ctx context.Context, d dispatch.Dispatcher, question string, files []string, mode string) QueryResult {
 	if mode == "" {
 		mode = ModeAnswer
 	}
@@ -48,12 +54,16 @@ func Query(ctx context.Context, dispatchPath string, question string, files []st
 	// Check cache before reading files.
 	key := cacheKey(question, files, mode)
 	if cached := cacheGet(key); cached != nil {
+		// No dispatch happened; the full file cost was avoided again.
+		cached.QueueWaitMs = 0
+		cached.Usage = dispatch.Usage{}
 		return *cached
 	}
 
 	// Read files into memory, validate existence and size.
 	fileContents := make(map[string]string, len(files))
 	totalLines := 0
+	fileTokens := 0
 	for _, path := range files {
 		info, err := os.Stat(path)
 		if err != nil {
@@ -84,99 +94,51 @@ func Query(ctx context.Context, dispatchPath string, question string, files []st
 		content := string(data)
 		fileContents[path] = content
 		totalLines += len(strings.Split(content, "\n"))
+		fileTokens += dispatch.EstimateTokens(content)
 	}
 
 	// Build prompt and dispatch to Codex.
 	prompt := BuildPrompt(question, fileContents, mode)
-
-	promptFile, err := os.CreateTemp("", "interserve-query-prompt-*.txt")
-	if err != nil {
-		return queryError(err, files, mode, "create prompt temp file")
-	}
-	promptPath := promptFile.Name()
-	defer os.Remove(promptPath)
-
-	if _, err := promptFile.WriteString(prompt); err != nil {
-		_ = promptFile.Close()
-		return queryError(err, files, mode, "write prompt temp file")
-	}
-	if err := promptFile.Close(); err != nil {
-		return queryError(err, files, mode, "close prompt temp file")
-	}
-
-	outputFile, err := os.CreateTemp("", "interserve-query-output-*.txt")
-	if err != nil {
-		return queryError(err, files, mode, "create output temp file")
-	}
-	outputPath := outputFile.Name()
-	if err := outputFile.Close(); err != nil {
-		return queryError(err, files, mode, "close output temp file")
-	}
-	defer os.Remove(outputPath)
-
-	cmd := exec.CommandContext(
-		ctx,
-		"bash",
-		dispatchPath,
-		"--tier", "fast",
-		"--sandbox", "read-only",
-		"--prompt-file", promptPath,
-		"-o", outputPath,
-	)
-	combined, err := cmd.CombinedOutput()
+	resp, err := d.Dispatch(ctx, dispatch.Request{Prompt: prompt, Tier: dispatch.TierFast, Tool: "codex_query"})
 	if err != nil {
-		stderr := strings.TrimSpace(string(combined))
-		if stderr == "" {
-			stderr = err.Error()
-		}
 		return QueryResult{
-			Status:        "error",
+			Status:        dispatch.ErrorStatus(err, "error"),
 			Mode:          mode,
 			FilesAnalyzed: files,
-			Error:         fmt.Sprintf("dispatch failed: %s", stderr),
+			QueueWaitMs:   resp.QueueWait.Milliseconds(),
+			Usage:         resp.Usage,
+			RetryAfterMs:  dispatch.RetryAfter(err).Milliseconds(),
+			Error:         fmt.Sprintf("dispatch failed: %v", err),
 		}
 	}
 
-	rawOutput, err := os.ReadFile(outputPath)
-	if err != nil {
-		return queryError(err, files, mode, "read dispatch output")
-	}
-
-	answer := strings.TrimSpace(string(rawOutput))
-	if answer == "" {
-		answer = strings.TrimSpace(string(combined))
-	}
-	answer = stripCodeFences(answer)
-
+	answer := stripCodeFences(resp.Output)
 	if answer == "" {
 		return QueryResult{
 			Status:        "error",
 			Mode:          mode,
 			FilesAnalyzed: files,
+			QueueWaitMs:   resp.QueueWait.Milliseconds(),
+			Usage:         resp.Usage,
 			Error:         "dispatch returned empty output",
 		}
 	}
 
 	result := QueryResult{
-		Status:         "success",
-		Answer:         answer,
-		FilesAnalyzed:  files,
-		LineCountSaved: totalLines,
-		Mode:           mode,
+		Status:               "success",
+		Answer:               answer,
+		FilesAnalyzed:        files,
+		LineCountSaved:       totalLines,
+		Mode:                 mode,
+		Backend:              resp.Backend,
+		QueueWaitMs:          resp.QueueWait.Milliseconds(),
+		Usage:                resp.Usage,
+		EstimatedTokensSaved: fileTokens - dispatch.EstimateTokens(answer),
 	}
 	cachePut(key, result, buildMtimes(files))
 	return result
 }
 
-func queryError(err error, files []string, mode string, context string) QueryResult {
-	return QueryResult{
-		Status:        "error",
-		Mode:          mode,
-		FilesAnalyzed: files,
-		Error:         fmt.Sprintf("%s: %v", context, err),
-	}
-}
-
 // stripCodeFences removes leading ```<lang> and trailing ``` from LLM output.
 func stripCodeFences(raw string) string {
 	trimmed := strings.TrimSpace(raw)
@@ -3,10 +3,15 @@ package query
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/mistakeknot/interserve/internal/dispatch"
 )
 
 // --- Prompt tests ---
@@ -104,7 +109,7 @@ func TestBuildPromptTruncatesLargeFiles(t *testing.T) {
 // These test input validation and response parsing without requiring Codex.
 
 func TestQueryErrorOnMissingFile(t *testing.T) {
-	result := Query(context.Background(), "/nonexistent/dispatch.sh", "question", []string{"/nonexistent/file.go"}, ModeAnswer)
+	result := Query(context.Background(), dispatch.NewShell("/nonexistent/dispatch.sh"), "question", []string{"/nonexistent/file.go"}, ModeAnswer)
 	if result.Status != "error" {
 		t.Fatalf("expected error status, got %q", result.Status)
 	}
@@ -114,7 +119,7 @@ func TestQueryErrorOnMissingFile(t *testing.T) {
 }
 
 func TestQueryErrorOnEmptyQuestion(t *testing.T) {
-	result := Query(context.Background(), "/nonexistent/dispatch.sh", "", []string{"/tmp/test.go"}, ModeAnswer)
+	result := Query(context.Background(), dispatch.NewShell("/nonexistent/dispatch.sh"), "", []string{"/tmp/test.go"}, ModeAnswer)
 	if result.Status != "error" {
 		t.Fatalf("expected error status, got %q", result.Status)
 	}
@@ -128,7 +133,7 @@ func TestQuerySummarizeModeAllowsEmptyQuestion(t *testing.T) {
 	tmp := writeTempFile(t, "package main\n")
 	defer os.Remove(tmp)
 
-	result := Query(context.Background(), "/nonexistent/dispatch.sh", "", []string{tmp}, ModeSummarize)
+	result := Query(context.Background(), dispatch.NewShell("/nonexistent/dispatch.sh"), "", []string{tmp}, ModeSummarize)
 	// Should get past validation (dispatch will fail since path doesn't exist)
 	if result.Error == "question is required for answer mode" {
 		t.Fatal("summarize mode should not require a question")
@@ -146,7 +151,7 @@ func TestQueryMaxFileSize(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	result := Query(context.Background(), "/nonexistent/dispatch.sh", "question", []string{tmp}, ModeAnswer)
+	result := Query(context.Background(), dispatch.NewShell("/nonexistent/dispatch.sh"), "question", []string{tmp}, ModeAnswer)
 	if result.Status != "error" {
 		t.Fatalf("expected error status, got %q", result.Status)
 	}
@@ -156,7 +161,7 @@ func TestQueryMaxFileSize(t *testing.T) {
 }
 
 func TestQueryInvalidMode(t *testing.T) {
-	result := Query(context.Background(), "/nonexistent/dispatch.sh", "question", []string{"/tmp/test.go"}, "invalid")
+	result := Query(context.Background(), dispatch.NewShell("/nonexistent/dispatch.sh"), "question", []string{"/tmp/test.go"}, "invalid")
 	if result.Status != "error" {
 		t.Fatalf("expected error status, got %q", result.Status)
 	}
@@ -189,7 +194,7 @@ func TestStripCodeFences(t *testing.T) {
 }
 
 func TestQueryNoFiles(t *testing.T) {
-	result := Query(context.Background(), "/nonexistent/dispatch.sh", "question", nil, ModeAnswer)
+	result := Query(context.Background(), dispatch.NewShell("/nonexistent/dispatch.sh"), "question", nil, ModeAnswer)
 	if result.Status != "error" {
 		t.Fatalf("expected error status, got %q", result.Status)
 	}
@@ -198,6 +203,78 @@ func TestQueryNoFiles(t *testing.T) {
 	}
 }
 
+func TestQueryAgainstOpenAICompatibleServer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"main prints hello"}}]}`))
+	}))
+	defer srv.Close()
+
+	tmp := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(tmp, []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	d := &dispatch.OpenAI{BaseURL: srv.URL, Model: "local"}
+	result := Query(context.Background(), d, "What does main do?", []string{tmp}, ModeAnswer)
+	if result.Status != "success" {
+		t.Fatalf("expected success, got %q: %s", result.Status, result.Error)
+	}
+	if result.Answer != "main prints hello" {
+		t.Fatalf("unexpected answer %q", result.Answer)
+	}
+}
+
+func TestQueryFallsBackToNextBackend(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"answered over http"}}]}`))
+	}))
+	defer srv.Close()
+
+	tmp := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(tmp, []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	d := dispatch.NewFallback([]dispatch.Backend{
+		{Name: "shell", Dispatcher: dispatch.NewShell("/nonexistent/dispatch.sh")},
+		{Name: "http", Dispatcher: &dispatch.OpenAI{BaseURL: srv.URL, Model: "local"}},
+	}, 0)
+	result := Query(context.Background(), d, "fallback question", []string{tmp}, ModeAnswer)
+	if result.Status != "success" || result.Backend != "http" {
+		t.Fatalf("expected http backend to answer, got %q from %q: %s", result.Status, result.Backend, result.Error)
+	}
+}
+
+func TestQueryReportsDispatchTimeout(t *testing.T) {
+	tmp := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(tmp, []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	d := dispatch.Func(func(ctx context.Context, req dispatch.Request) (dispatch.Response, error) {
+		return dispatch.Response{}, fmt.Errorf("%w after 5m0s", dispatch.ErrTimeout)
+	})
+	result := Query(context.Background(), d, "timeout question", []string{tmp}, ModeAnswer)
+	if result.Status != "timeout" {
+		t.Fatalf("expected timeout status, got %q: %s", result.Status, result.Error)
+	}
+}
+
+func TestQueryReportsBackendUnavailable(t *testing.T) {
+	tmp := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(tmp, []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	d := dispatch.Func(func(ctx context.Context, req dispatch.Request) (dispatch.Response, error) {
+		return dispatch.Response{}, &dispatch.BreakerOpenError{RetryAfter: 30 * time.Second}
+	})
+	result := Query(context.Background(), d, "unavailable question", []string{tmp}, ModeAnswer)
+	if result.Status != "backend_unavailable" || result.RetryAfterMs != 30000 {
+		t.Fatalf("expected backend_unavailable with retry hint, got %q/%d: %s", result.Status, result.RetryAfterMs, result.Error)
+	}
+}
+
 func writeTempFile(t *testing.T, content string) string {
 	t.Helper()
 	f, err := os.CreateTemp("", "interserve-test-*.go")
@@ -211,3 +288,21 @@ func writeTempFile(t *testing.T, content string) string {
 	_ = f.Close()
 	return f.Name()
 }
+
+// TestQueryReplaySample runs the query pipeline offline against a recorded dispatch.
+func TestQueryReplaySample(t *testing.T) {
+	question := "What does Retry return when every attempt fails?"
+	result := Query(context.Background(), dispatch.NewReplayer("testdata/replay"), question, []string{"testdata/sample.go"}, ModeAnswer)
+	if result.Status != "success" {
+		t.Fatalf("replay failed (%q): %s", result.Status, result.Error)
+	}
+	if !strings.Contains(result.Answer, "final attempt") {
+		t.Fatalf("unexpected recorded answer %q", result.Answer)
+	}
+	if result.LineCountSaved != 13 {
+		t.Fatalf("expected 13 lines saved, got %d", result.LineCountSaved)
+	}
+	if result.EstimatedTokensSaved <= 0 {
+		t.Fatalf("expected positive token savings, got %d", result.EstimatedTokensSaved)
+	}
+}
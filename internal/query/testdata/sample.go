@@ -0,0 +1,12 @@
+package sample
+
+// Retry calls fn up to attempts times and returns the last error.
+func Retry(attempts int, fn func() error) error {
+	var err error
+	for i := 0; i < attempts; i++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+	}
+	return err
+}
@@ -0,0 +1,226 @@
+// Package tempfiles renders the per-agent documents a classification
+// describes and writes them where review agents can read them.
+package tempfiles
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mistakeknot/interserve/internal/classify"
+	"github.com/mistakeknot/interserve/internal/extract"
+)
+
+// RenderAgentDocuments returns a ready-to-send document for every agent in
+// slicing with at least one priority section. Priority sections appear in
+// full, context sections as their heading and condensed opening lines, and
+// each run of omitted sections as a marker giving its line range in docName.
+func RenderAgentDocuments(docName string, sections []extract.Section, slicing map[string]classify.AgentSlice) map[string]string {
+	docs := make(map[string]string, len(slicing))
+	for agent, slice := range slicing {
+		if len(slice.PrioritySections) == 0 {
+			continue
+		}
+		docs[agent] = Render(docName, agent, sections, slice)
+	}
+	return docs
+}
+
+// Render returns agent's document for slice.
+func Render(docName, agent string, sections []extract.Section, slice classify.AgentSlice) string {
+	priority := idSet(slice.PrioritySections)
+	context := idSet(slice.ContextSections)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<!-- interserve: %s slice of %s; priority %s; context %s -->\n",
+		agent, docName, idList(slice.PrioritySections), idList(slice.ContextSections))
+
+	var omitted []extract.Section
+	flush := func() {
+		if len(omitted) == 0 {
+			return
+		}
+		b.WriteString("\n" + omissionMarker(omitted) + "\n")
+		omitted = nil
+	}
+	for _, section := range sections {
+		switch {
+		case priority[section.ID]:
+			flush()
+			b.WriteString("\n")
+			if section.Level > 0 {
+				b.WriteString(headingLine(section) + "\n")
+			}
+			b.WriteString(strings.TrimRight(section.Body, "\n") + "\n")
+		case context[section.ID]:
+			flush()
+			b.WriteString("\n" + headingLine(section) + "\n")
+			fmt.Fprintf(&b, "> Context only%s.\n", lineSpan(section.StartLine, section.EndLine))
+			if condensed := section.Condensed(); condensed != "" {
+				for _, line := range strings.Split(condensed, "\n") {
+					b.WriteString("> " + line + "\n")
+				}
+			}
+		default:
+			omitted = append(omitted, section)
+		}
+	}
+	flush()
+	return b.String()
+}
+
+// root is this process's private temporary directory; every
+// GenerateAgentFiles call writes into its own subdirectory, and Cleanup removes
+// the lot.
+var root struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// GenerateAgentFiles renders each agent's document into a new private
+// directory under the process's temporary root and returns the file path per
+// agent. Nothing is left behind on failure; the files live until Cleanup.
+func GenerateAgentFiles(docName string, sections []extract.Section, slicing map[string]classify.AgentSlice) (map[string]string, error) {
+	docs := RenderAgentDocuments(docName, sections, slicing)
+	if len(docs) == 0 {
+		return map[string]string{}, nil
+	}
+
+	stem := strings.TrimSuffix(filepath.Base(docName), filepath.Ext(docName))
+	parent, err := rootDir()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(parent, safeName(stem)+"-*")
+	if err != nil {
+		return nil, fmt.Errorf("create temp dir: %w", err)
+	}
+
+	agents := make([]string, 0, len(docs))
+	for agent := range docs {
+		agents = append(agents, agent)
+	}
+	sort.Strings(agents)
+
+	files := make(map[string]string, len(docs))
+	for _, agent := range agents {
+		path := filepath.Join(dir, safeName(agent)+".md")
+		if err := writeNew(path, docs[agent]); err != nil {
+			_ = os.RemoveAll(dir)
+			return nil, fmt.Errorf("write agent temp file for %s: %w", agent, err)
+		}
+		files[agent] = path
+	}
+	return files, nil
+}
+
+// Cleanup removes every directory GenerateAgentFiles has written. The server
+// calls it on shutdown; a later GenerateAgentFiles starts a fresh root.
+func Cleanup() error {
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	if root.dir == "" {
+		return nil
+	}
+	err := os.RemoveAll(root.dir)
+	root.dir = ""
+	return err
+}
+
+// rootDir returns the process's temporary root, creating it on first use.
+func rootDir() (string, error) {
+	root.mu.Lock()
+	defer root.mu.Unlock()
+	if root.dir == "" {
+		dir, err := os.MkdirTemp("", "interserve-*")
+		if err != nil {
+			return "", fmt.Errorf("create temp dir: %w", err)
+		}
+		root.dir = dir
+	}
+	return root.dir, nil
+}
+
+// writeNew writes content to a file that must not already exist.
+func writeNew(path, content string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(content); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// headingLine rebuilds a section's heading; the preamble gets a level-2 one.
+func headingLine(section extract.Section) string {
+	level := section.Level
+	if level == 0 {
+		level = 2
+	}
+	return strings.Repeat("#", level) + " " + section.Heading
+}
+
+// omissionMarker describes a run of omitted sections.
+func omissionMarker(run []extract.Section) string {
+	first, last := run[0], run[len(run)-1]
+	what := fmt.Sprintf("section %d", first.ID)
+	if len(run) > 1 {
+		what = fmt.Sprintf("%d sections (%d-%d)", len(run), first.ID, last.ID)
+	}
+	return fmt.Sprintf("[... %s omitted%s ...]", what, lineSpan(first.StartLine, last.EndLine))
+}
+
+// lineSpan renders ", lines a-b" when the source position is known.
+func lineSpan(start, end int) string {
+	switch {
+	case start == 0:
+		return ""
+	case start == end:
+		return fmt.Sprintf(", line %d", start)
+	default:
+		return fmt.Sprintf(", lines %d-%d", start, end)
+	}
+}
+
+func idSet(ids []int) map[int]bool {
+	set := make(map[int]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+func idList(ids []int) string {
+	if len(ids) == 0 {
+		return "none"
+	}
+	parts := make([]string, 0, len(ids))
+	for _, id := range ids {
+		parts = append(parts, strconv.Itoa(id))
+	}
+	return strings.Join(parts, ",")
+}
+
+// safeName keeps letters, digits, '-', '_' and '.' so name is a single path element.
+func safeName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('_')
+		}
+	}
+	if s := strings.Trim(b.String(), "."); s != "" {
+		return s
+	}
+	return "doc"
+}
@@ -0,0 +1,130 @@
+package tempfiles
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mistakeknot/interserve/internal/classify"
+	"github.com/mistakeknot/interserve/internal/extract"
+)
+
+const planDoc = `intro line
+## Threat model
+Stolen tokens let an attacker act as the user.
+Tokens are revoked on logout.
+## Rotation
+Invalidate the old pair first.
+Then issue the new pair.
+Use compare-and-swap.
+Retry on conflict.
+## Latency
+p99 under 150ms.
+## Rollout
+Staff first.
+`
+
+func TestRenderSlicesDocument(t *testing.T) {
+	sections := extract.ExtractSections(planDoc)
+	slice := classify.AgentSlice{PrioritySections: []int{2}, ContextSections: []int{3}}
+
+	got := Render("plan.md", "fd-safety", sections, slice)
+	want := `<!-- interserve: fd-safety slice of plan.md; priority 2; context 3 -->
+
+[... section 1 omitted, line 1 ...]
+
+## Threat model
+Stolen tokens let an attacker act as the user.
+Tokens are revoked on logout.
+
+## Rotation
+> Context only, lines 5-9.
+> Invalidate the old pair first.
+> Then issue the new pair.
+> Use compare-and-swap.
+> [... 1 more line ...]
+
+[... 2 sections (4-5) omitted, lines 10-13 ...]
+`
+	if got != want {
+		t.Fatalf("rendered document:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestRenderAgentDocumentsSkipsAgentsWithoutPriority(t *testing.T) {
+	sections := extract.ExtractSections(planDoc)
+	docs := RenderAgentDocuments("plan.md", sections, map[string]classify.AgentSlice{
+		"fd-safety":      {PrioritySections: []int{2}},
+		"fd-correctness": {ContextSections: []int{3}},
+	})
+	if len(docs) != 1 || docs["fd-safety"] == "" {
+		t.Fatalf("expected only fd-safety to get a document, got %v", docs)
+	}
+}
+
+func TestGenerateAgentFiles(t *testing.T) {
+	sections := extract.ExtractSections(planDoc)
+	files, err := GenerateAgentFiles("/docs/plan.md", sections, map[string]classify.AgentSlice{
+		"fd-safety":      {PrioritySections: []int{2}},
+		"fd-performance": {PrioritySections: []int{4}, ContextSections: []int{3}},
+		"fd/../escape":   {PrioritySections: []int{5}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { Cleanup() })
+
+	if len(files) != 3 {
+		t.Fatalf("expected 3 files, got %v", files)
+	}
+	dir := filepath.Dir(files["fd-safety"])
+	if !strings.HasPrefix(filepath.Base(dir), "plan-") || !strings.HasPrefix(filepath.Base(filepath.Dir(dir)), "interserve-") {
+		t.Fatalf("unexpected temp dir %q", dir)
+	}
+	for agent, path := range files {
+		if filepath.Dir(path) != dir {
+			t.Fatalf("%s escaped the temp dir: %q", agent, path)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0o600 {
+			t.Fatalf("%s file mode %v, want 0600", agent, info.Mode().Perm())
+		}
+	}
+	content, err := os.ReadFile(files["fd-performance"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(content), "## Latency\np99 under 150ms.") {
+		t.Fatalf("fd-performance document is missing its priority section:\n%s", content)
+	}
+}
+
+func TestCleanupRemovesEveryRender(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	sections := extract.ExtractSections(planDoc)
+	slicing := map[string]classify.AgentSlice{"fd-safety": {PrioritySections: []int{2}}}
+
+	first, err := GenerateAgentFiles("/docs/plan.md", sections, slicing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := GenerateAgentFiles("/docs/plan.md", sections, slicing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstDir, secondDir := filepath.Dir(first["fd-safety"]), filepath.Dir(second["fd-safety"])
+	if firstDir == secondDir || filepath.Dir(firstDir) != filepath.Dir(secondDir) {
+		t.Fatalf("renders should get their own directories under one root: %q, %q", firstDir, secondDir)
+	}
+
+	if err := Cleanup(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Dir(firstDir)); !os.IsNotExist(err) {
+		t.Fatalf("Cleanup left the temp root behind: %v", err)
+	}
+}
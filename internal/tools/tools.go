@@ -5,59 +5,124 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 	"github.com/mistakeknot/interserve/internal/classify"
+	"github.com/mistakeknot/interserve/internal/dispatch"
 	"github.com/mistakeknot/interserve/internal/extract"
 	"github.com/mistakeknot/interserve/internal/query"
+	"github.com/mistakeknot/interserve/internal/tempfiles"
 )
 
+// Config carries the dispatcher and server-wide defaults shared by tool handlers.
+type Config struct {
+	Dispatcher dispatch.Dispatcher
+	Classify   classify.Options
+	// Ledger, Limiter and Breaker are optional; when set they are reported by diagnostics.
+	Ledger  *dispatch.Ledger
+	Limiter *dispatch.Limiter
+	Breaker *dispatch.Breaker
+}
+
 // RegisterAll registers all interserve MCP tools.
-func RegisterAll(s *server.MCPServer, dispatchPath string) {
+func RegisterAll(s *server.MCPServer, cfg Config) {
 	s.AddTools(
 		extractSectionsTool(),
-		classifySectionsTool(dispatchPath),
-		codexQueryTool(dispatchPath),
+		getSectionsTool(),
+		classifySectionsTool(cfg),
+		codexQueryTool(cfg),
+		diagnosticsTool(cfg),
 	)
 }
 
 type extractSectionResult struct {
 	SectionID     int    `json:"section_id"`
 	Heading       string `json:"heading"`
+	Slug          string `json:"slug,omitempty"`
+	StableID      string `json:"stable_id"`
+	ContentHash   string `json:"content_hash"`
+	Level         int    `json:"level,omitempty"`
+	ParentID      int    `json:"parent_id,omitempty"`
 	LineCount     int    `json:"line_count"`
+	StartLine     int    `json:"start_line"`
+	EndLine       int    `json:"end_line"`
+	StartByte     int    `json:"start_byte"`
+	EndByte       int    `json:"end_byte"`
 	FirstSentence string `json:"first_sentence"`
 }
 
+type extractNodeResult struct {
+	SectionID      int                 `json:"section_id"`
+	Heading        string              `json:"heading"`
+	Slug           string              `json:"slug,omitempty"`
+	StableID       string              `json:"stable_id"`
+	ContentHash    string              `json:"content_hash"`
+	Level          int                 `json:"level"`
+	LineCount      int                 `json:"line_count"`
+	TotalLineCount int                 `json:"total_line_count"`
+	StartLine      int                 `json:"start_line"`
+	EndLine        int                 `json:"end_line"`
+	FirstSentence  string              `json:"first_sentence"`
+	Children       []extractNodeResult `json:"children"`
+}
+
 func extractSectionsTool() server.ServerTool {
 	return server.ServerTool{
 		Tool: mcp.NewTool("extract_sections",
-			mcp.WithDescription("Split markdown by ## headings while honoring fenced code blocks."),
+			mcp.WithDescription("Split markdown by ## headings (or any heading levels) while honoring fenced code blocks, optionally as a nested heading tree."),
 			mcp.WithString("file_path",
 				mcp.Description("Absolute or workspace-relative markdown file path"),
 				mcp.Required(),
 			),
+			mcp.WithNumber("min_level",
+				mcp.Description("Shallowest heading level (1-6) that starts a section (default 2)."),
+			),
+			mcp.WithNumber("max_level",
+				mcp.Description("Deepest heading level (1-6) that starts a section (default 2, or min_level if deeper)."),
+			),
+			mcp.WithBoolean("tree",
+				mcp.Description("Return sections nested under their parent headings instead of a flat list."),
+			),
 		),
 		Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 			_ = ctx
-			filePath, errText := requiredString(req.GetArguments(), "file_path")
+			args := req.GetArguments()
+			filePath, errText := requiredString(args, "file_path")
 			if errText != "" {
 				return mcp.NewToolResultError(errText), nil
 			}
+			levels, err := levelsArg(args)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
 
 			doc, err := os.ReadFile(filePath)
 			if err != nil {
 				return mcp.NewToolResultError(fmt.Sprintf("read %s: %v", filePath, err)), nil
 			}
 
-			sections := extract.ExtractSections(string(doc))
+			sections := extract.ExtractLevels(string(doc), levels)
+			if tree, _ := args["tree"].(bool); tree {
+				return jsonResult(nodeResults(extract.Tree(sections)))
+			}
 			response := make([]extractSectionResult, 0, len(sections))
 			for _, section := range sections {
 				response = append(response, extractSectionResult{
 					SectionID:     section.ID,
 					Heading:       section.Heading,
+					Slug:          section.Slug,
+					StableID:      section.StableID,
+					ContentHash:   section.ContentHash,
+					Level:         section.Level,
+					ParentID:      section.Parent,
 					LineCount:     section.LineCount,
+					StartLine:     section.StartLine,
+					EndLine:       section.EndLine,
+					StartByte:     section.StartByte,
+					EndByte:       section.EndByte,
 					FirstSentence: section.FirstSentence(),
 				})
 			}
@@ -66,16 +131,206 @@ func extractSectionsTool() server.ServerTool {
 	}
 }
 
-func classifySectionsTool(dispatchPath string) server.ServerTool {
+func nodeResults(nodes []extract.Node) []extractNodeResult {
+	out := make([]extractNodeResult, 0, len(nodes))
+	for _, node := range nodes {
+		out = append(out, extractNodeResult{
+			SectionID:      node.ID,
+			Heading:        node.Heading,
+			Slug:           node.Slug,
+			StableID:       node.StableID,
+			ContentHash:    node.ContentHash,
+			Level:          node.Level,
+			LineCount:      node.LineCount,
+			TotalLineCount: node.TotalLines(),
+			StartLine:      node.StartLine,
+			EndLine:        node.TreeEndLine(),
+			FirstSentence:  node.FirstSentence(),
+			Children:       nodeResults(node.Children),
+		})
+	}
+	return out
+}
+
+type sectionBodyResult struct {
+	SectionID   int    `json:"section_id"`
+	Heading     string `json:"heading"`
+	Slug        string `json:"slug,omitempty"`
+	StableID    string `json:"stable_id"`
+	ContentHash string `json:"content_hash"`
+	StartLine   int    `json:"start_line"`
+	EndLine     int    `json:"end_line"`
+	LineCount   int    `json:"line_count"`
+	Body        string `json:"body"`
+}
+
+type sectionContextResult struct {
+	SectionID   int    `json:"section_id"`
+	Heading     string `json:"heading"`
+	Slug        string `json:"slug,omitempty"`
+	StableID    string `json:"stable_id"`
+	ContentHash string `json:"content_hash"`
+	StartLine   int    `json:"start_line"`
+	EndLine     int    `json:"end_line"`
+	Condensed   string `json:"condensed"`
+}
+
+type getSectionsResult struct {
+	Sections []sectionBodyResult    `json:"sections"`
+	Context  []sectionContextResult `json:"context,omitempty"`
+}
+
+func getSectionsTool() server.ServerTool {
+	return server.ServerTool{
+		Tool: mcp.NewTool("get_sections",
+			mcp.WithDescription("Return the bodies of selected markdown sections, by section ID, stable ID, exact heading, anchor slug or content hash, optionally with other sections condensed to their opening lines."),
+			mcp.WithString("file_path",
+				mcp.Description("Absolute or workspace-relative markdown file path"),
+				mcp.Required(),
+			),
+			mcp.WithArray("sections",
+				mcp.Description("Sections to return in full: IDs (as numbers or strings), stable IDs such as \"auth/token-rotation\" that survive edits elsewhere in the document, exact headings, slugs such as \"threat-model\", or content hashes (8+ characters)."),
+				mcp.Required(),
+			),
+			mcp.WithArray("context",
+				mcp.Description("Sections to include condensed, e.g. an agent's context_sections from classify_sections. Same reference forms as sections."),
+			),
+			mcp.WithNumber("min_level",
+				mcp.Description("Shallowest heading level (1-6) that starts a section (default 2); match what produced the IDs."),
+			),
+			mcp.WithNumber("max_level",
+				mcp.Description("Deepest heading level (1-6) that starts a section (default 2)."),
+			),
+		),
+		Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			_ = ctx
+			args := req.GetArguments()
+			filePath, errText := requiredString(args, "file_path")
+			if errText != "" {
+				return mcp.NewToolResultError(errText), nil
+			}
+			refs := refsArg(args["sections"])
+			if len(refs) == 0 {
+				return mcp.NewToolResultError("sections must name at least one section"), nil
+			}
+			levels, err := levelsArg(args)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+
+			doc, err := os.ReadFile(filePath)
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("read %s: %v", filePath, err)), nil
+			}
+			sections := extract.ExtractLevels(string(doc), levels)
+
+			full, err := lookupSections(sections, refs, nil)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			seen := make(map[int]bool, len(full))
+			result := getSectionsResult{Sections: make([]sectionBodyResult, 0, len(full))}
+			for _, section := range full {
+				seen[section.ID] = true
+				result.Sections = append(result.Sections, sectionBodyResult{
+					SectionID:   section.ID,
+					Heading:     section.Heading,
+					Slug:        section.Slug,
+					StableID:    section.StableID,
+					ContentHash: section.ContentHash,
+					StartLine:   section.StartLine,
+					EndLine:     section.EndLine,
+					LineCount:   section.LineCount,
+					Body:        section.Body,
+				})
+			}
+
+			condensed, err := lookupSections(sections, refsArg(args["context"]), seen)
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("context: %v", err)), nil
+			}
+			for _, section := range condensed {
+				result.Context = append(result.Context, sectionContextResult{
+					SectionID:   section.ID,
+					Heading:     section.Heading,
+					Slug:        section.Slug,
+					StableID:    section.StableID,
+					ContentHash: section.ContentHash,
+					StartLine:   section.StartLine,
+					EndLine:     section.EndLine,
+					Condensed:   section.Condensed(),
+				})
+			}
+			return jsonResult(result)
+		},
+	}
+}
+
+// lookupSections resolves refs in order, skipping repeats and sections in skip.
+func lookupSections(sections []extract.Section, refs []string, skip map[int]bool) ([]extract.Section, error) {
+	var out []extract.Section
+	seen := make(map[int]bool, len(refs))
+	for _, ref := range refs {
+		section, err := extract.Lookup(sections, ref)
+		if err != nil {
+			return nil, err
+		}
+		if seen[section.ID] || skip[section.ID] {
+			continue
+		}
+		seen[section.ID] = true
+		out = append(out, section)
+	}
+	return out, nil
+}
+
+// classifyResponse is a classification plus any per-agent documents rendered from it.
+type classifyResponse struct {
+	classify.ClassifyResult
+	Documents map[string]string `json:"documents,omitempty"`
+	Files     map[string]string `json:"files,omitempty"`
+}
+
+func classifySectionsTool(cfg Config) server.ServerTool {
 	return server.ServerTool{
 		Tool: mcp.NewTool("classify_sections",
-			mcp.WithDescription("Classify markdown sections into flux-drive domains via Codex spark dispatch."),
+			mcp.WithDescription("Classify markdown sections into flux-drive domains via Codex spark dispatch, falling back to a local keyword classifier."),
 			mcp.WithString("file_path",
 				mcp.Description("Absolute or workspace-relative markdown file path"),
 				mcp.Required(),
 			),
+			mcp.WithNumber("min_level",
+				mcp.Description("Shallowest heading level (1-6) that starts a section (default 2)."),
+			),
+			mcp.WithNumber("max_level",
+				mcp.Description("Deepest heading level (1-6) that starts a section; 3 or more classifies subsections separately (default 2)."),
+			),
 			mcp.WithArray("agents",
-				mcp.Description("Optional agents override. Accepts array of names or {name,description} objects."),
+				mcp.Description("Optional agents override, layered over the project's .interserve/agents.yaml (or the built-in agents). Accepts array of names or {name,description,keywords,cross_cutting,min_confidence,slicing,token_budget} objects."),
+			),
+			mcp.WithObject("slicing",
+				mcp.Description("Slicing policy override: {mismatch_floor, full_doc_ceiling, min_priority_confidence, count_context}. Fractions are 0-1 of document lines."),
+			),
+			mcp.WithNumber("token_budget",
+				mcp.Description("Estimated-token cap on each agent's priority sections (agents' own token_budget wins). Overflow is demoted to context. 0 is unlimited."),
+			),
+			mcp.WithString("method",
+				mcp.Description("Classification method: dispatch (default, model via backend) or local (offline keyword/TF-IDF scoring)."),
+			),
+			mcp.WithBoolean("escalate",
+				mcp.Description("Re-run weak fast-tier results on the deep tier (default true)."),
+			),
+			mcp.WithNumber("escalation_min_confidence",
+				mcp.Description("Average confidence floor (0-1) below which the deep tier is tried."),
+			),
+			mcp.WithNumber("samples",
+				mcp.Description("Number of concurrent classification samples merged by majority vote (default 1, max 7)."),
+			),
+			mcp.WithBoolean("cache",
+				mcp.Description("Reuse earlier assignments for unchanged sections and dispatch only new or edited ones (default true)."),
+			),
+			mcp.WithString("render",
+				mcp.Description("Also build each agent's sliced document (priority sections in full, context condensed, omissions marked): inline returns them in documents, files writes them to a temp dir and returns paths in files."),
 			),
 		),
 		Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
@@ -85,24 +340,91 @@ func classifySectionsTool(dispatchPath string) server.ServerTool {
 				return mcp.NewToolResultError(errText), nil
 			}
 
+			levels, err := levelsArg(args)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			render, _ := args["render"].(string)
+			switch render = strings.TrimSpace(render); render {
+			case "", "inline", "files":
+			default:
+				return mcp.NewToolResultError(fmt.Sprintf("invalid render %q: must be inline or files", render)), nil
+			}
+
 			doc, err := os.ReadFile(filePath)
 			if err != nil {
 				return mcp.NewToolResultError(fmt.Sprintf("read %s: %v", filePath, err)), nil
 			}
 
-			sections := extract.ExtractSections(string(doc))
-			agents := parseAgentsArg(args["agents"])
+			sections := extract.ExtractLevels(string(doc), levels)
+			registry, registryPath, err := classify.AgentsForDocument(filePath)
+			if err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("agent registry: %v", err)), nil
+			}
+			agents := parseAgentsArg(args["agents"], registry)
 			if len(agents) == 0 {
-				agents = classify.DefaultAgents()
+				agents = registry
+			}
+			if err := classify.ValidateAgents(agents); err != nil {
+				return mcp.NewToolResultError(fmt.Sprintf("agents: %v", err)), nil
 			}
 
-			result := classify.Classify(ctx, dispatchPath, sections, agents)
-			return jsonResult(result)
+			opts := cfg.Classify
+			if escalate, ok := args["escalate"].(bool); ok {
+				opts.DisableEscalation = !escalate
+			}
+			if floor, ok := args["escalation_min_confidence"].(float64); ok {
+				if floor < 0 || floor > 1 {
+					return mcp.NewToolResultError("escalation_min_confidence must be between 0 and 1"), nil
+				}
+				opts.EscalationMinConfidence = floor
+			}
+			if samples, ok := args["samples"].(float64); ok {
+				opts.Samples = int(samples)
+			}
+			if useCache, ok := args["cache"].(bool); ok && !useCache {
+				opts.Cache = nil
+			}
+			if method, ok := args["method"].(string); ok {
+				opts.Method = strings.TrimSpace(method)
+			}
+			if budget, ok := args["token_budget"].(float64); ok {
+				if budget < 0 {
+					return mcp.NewToolResultError("token_budget must not be negative"), nil
+				}
+				opts.TokenBudget = int(budget)
+			}
+			if slicing, ok := policyArg(args["slicing"]); ok {
+				if err := slicing.Validate(); err != nil {
+					return mcp.NewToolResultError(fmt.Sprintf("slicing: %v", err)), nil
+				}
+				opts.Slicing = opts.Slicing.Merge(slicing)
+			}
+
+			result := classify.Classify(ctx, cfg.Dispatcher, sections, agents, opts)
+			result.AgentRegistry = registryPath
+			if cfg.Ledger != nil && result.Status == "success" {
+				cfg.Ledger.RecordContextSaved("classify_sections", result.ContextTokensSaved(sections))
+			}
+			response := classifyResponse{ClassifyResult: result}
+			if result.Status == "success" {
+				switch render {
+				case "inline":
+					response.Documents = tempfiles.RenderAgentDocuments(filePath, sections, result.SlicingMap)
+				case "files":
+					files, err := tempfiles.GenerateAgentFiles(filePath, sections, result.SlicingMap)
+					if err != nil {
+						return mcp.NewToolResultError(fmt.Sprintf("render: %v", err)), nil
+					}
+					response.Files = files
+				}
+			}
+			return jsonResult(response)
 		},
 	}
 }
 
-func codexQueryTool(dispatchPath string) server.ServerTool {
+func codexQueryTool(cfg Config) server.ServerTool {
 	return server.ServerTool{
 		Tool: mcp.NewTool("codex_query",
 			mcp.WithDescription("Ask interserve to analyze file(s) and return a compact answer. Saves Claude context by delegating file reading to Codex."),
@@ -142,22 +464,70 @@ func codexQueryTool(dispatchPath string) server.ServerTool {
 				return mcp.NewToolResultError("files must contain at least one valid file path"), nil
 			}
 
-			result := query.Query(ctx, dispatchPath, question, files, mode)
+			result := query.Query(ctx, cfg.Dispatcher, question, files, mode)
+			if cfg.Ledger != nil && result.Status == "success" {
+				cfg.Ledger.RecordContextSaved("codex_query", result.EstimatedTokensSaved)
+			}
 			return jsonResult(result)
 		},
 	}
 }
 
-func parseAgentsArg(raw any) []classify.AgentDomain {
+type diagnosticsResult struct {
+	Ledger        *dispatch.LedgerSnapshot `json:"ledger,omitempty"`
+	Queue         *queueStats              `json:"queue,omitempty"`
+	Breaker       *dispatch.BreakerState   `json:"breaker,omitempty"`
+	QueryCache    string                   `json:"query_cache"`
+	ClassifyCache *classify.CacheStats     `json:"classify_cache,omitempty"`
+}
+
+type queueStats struct {
+	InFlight int `json:"in_flight"`
+	Queued   int `json:"queued"`
+}
+
+func diagnosticsTool(cfg Config) server.ServerTool {
+	return server.ServerTool{
+		Tool: mcp.NewTool("diagnostics",
+			mcp.WithDescription("Report interserve session state: per-tool dispatch usage and token savings, dispatch queue depth, backend circuit breaker state, and query and classification cache stats."),
+		),
+		Handler: func(ctx context.Context, req mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			_ = ctx
+			result := diagnosticsResult{QueryCache: query.CacheStats()}
+			if cfg.Ledger != nil {
+				snap := cfg.Ledger.Snapshot()
+				result.Ledger = &snap
+			}
+			if cfg.Limiter != nil {
+				inFlight, queued := cfg.Limiter.Stats()
+				result.Queue = &queueStats{InFlight: inFlight, Queued: queued}
+			}
+			if cfg.Breaker != nil {
+				state := cfg.Breaker.State()
+				result.Breaker = &state
+			}
+			if cfg.Classify.Cache != nil {
+				stats := cfg.Classify.Cache.Stats()
+				result.ClassifyCache = &stats
+			}
+			return jsonResult(result)
+		},
+	}
+}
+
+// parseAgentsArg layers the agents argument over registry. Names select
+// registry entries (or add bare agents); objects override the fields they set.
+// Registry cross-cutting agents are always kept. It returns nil when the
+// argument names no agents.
+func parseAgentsArg(raw any, registry []classify.AgentDomain) []classify.AgentDomain {
 	items, ok := raw.([]any)
 	if !ok || len(items) == 0 {
 		return nil
 	}
 
-	defaults := classify.DefaultAgents()
-	defaultDescriptions := make(map[string]string, len(defaults))
-	for _, agent := range defaults {
-		defaultDescriptions[agent.Name] = agent.Description
+	defaults := make(map[string]classify.AgentDomain, len(registry))
+	for _, agent := range registry {
+		defaults[agent.Name] = agent
 	}
 
 	result := make([]classify.AgentDomain, 0, len(items))
@@ -169,10 +539,9 @@ func parseAgentsArg(raw any) []classify.AgentDomain {
 			if name == "" || seen[name] {
 				continue
 			}
-			result = append(result, classify.AgentDomain{
-				Name:        name,
-				Description: defaultDescriptions[name],
-			})
+			agent := defaults[name]
+			agent.Name = name
+			result = append(result, agent)
 			seen[name] = true
 		case map[string]any:
 			name, _ := v["name"].(string)
@@ -180,15 +549,31 @@ func parseAgentsArg(raw any) []classify.AgentDomain {
 			if name == "" || seen[name] {
 				continue
 			}
-			description, _ := v["description"].(string)
-			description = strings.TrimSpace(description)
-			if description == "" {
-				description = defaultDescriptions[name]
+			agent := defaults[name]
+			agent.Name = name
+			if description, _ := v["description"].(string); strings.TrimSpace(description) != "" {
+				agent.Description = strings.TrimSpace(description)
+			}
+			if keywords := stringsArg(v["keywords"]); keywords != nil {
+				agent.Keywords = keywords
+			}
+			if crossCutting, ok := v["cross_cutting"].(bool); ok {
+				agent.CrossCutting = crossCutting
+			}
+			if slicing, ok := policyArg(v["slicing"]); ok {
+				merged := slicing
+				if agent.Slicing != nil {
+					merged = agent.Slicing.Merge(slicing)
+				}
+				agent.Slicing = &merged
+			}
+			if floor, ok := v["min_confidence"].(float64); ok {
+				agent.MinConfidence = floor
+			}
+			if budget, ok := v["token_budget"].(float64); ok {
+				agent.TokenBudget = int(budget)
 			}
-			result = append(result, classify.AgentDomain{
-				Name:        name,
-				Description: description,
-			})
+			result = append(result, agent)
 			seen[name] = true
 		}
 	}
@@ -196,9 +581,85 @@ func parseAgentsArg(raw any) []classify.AgentDomain {
 	if len(result) == 0 {
 		return nil
 	}
+	for _, agent := range registry {
+		if agent.CrossCutting && !seen[agent.Name] {
+			result = append(result, agent)
+		}
+	}
 	return result
 }
 
+// levelsArg reads min_level and max_level. max_level defaults to the deeper
+// of 2 and min_level.
+func levelsArg(args map[string]any) (extract.Levels, error) {
+	levels := extract.DefaultLevels()
+	if n, ok := args["min_level"].(float64); ok {
+		levels.Min = int(n)
+		levels.Max = max(levels.Max, levels.Min)
+	}
+	if n, ok := args["max_level"].(float64); ok {
+		levels.Max = int(n)
+	}
+	return levels, levels.Validate()
+}
+
+// policyArg reads a slicing policy override object; ok is false when raw is not an object.
+func policyArg(raw any) (classify.PolicyOverride, bool) {
+	v, ok := raw.(map[string]any)
+	if !ok {
+		return classify.PolicyOverride{}, false
+	}
+	var o classify.PolicyOverride
+	if f, ok := v["mismatch_floor"].(float64); ok {
+		o.MismatchFloor = &f
+	}
+	if f, ok := v["full_doc_ceiling"].(float64); ok {
+		o.FullDocCeiling = &f
+	}
+	if f, ok := v["min_priority_confidence"].(float64); ok {
+		o.MinPriorityConfidence = &f
+	}
+	if b, ok := v["count_context"].(bool); ok {
+		o.CountContext = &b
+	}
+	return o, true
+}
+
+// refsArg reads section references given as strings or numbers.
+func refsArg(raw any) []string {
+	items, ok := raw.([]any)
+	if !ok {
+		return nil
+	}
+	var out []string
+	for _, item := range items {
+		switch v := item.(type) {
+		case float64:
+			out = append(out, strconv.Itoa(int(v)))
+		case string:
+			if strings.TrimSpace(v) != "" {
+				out = append(out, v)
+			}
+		}
+	}
+	return out
+}
+
+// stringsArg returns the non-blank strings in a JSON array argument, or nil.
+func stringsArg(raw any) []string {
+	items, ok := raw.([]any)
+	if !ok {
+		return nil
+	}
+	var out []string
+	for _, item := range items {
+		if s, ok := item.(string); ok && strings.TrimSpace(s) != "" {
+			out = append(out, strings.TrimSpace(s))
+		}
+	}
+	return out
+}
+
 func requiredString(args map[string]any, key string) (string, string) {
 	value, _ := args[key].(string)
 	value = strings.TrimSpace(value)
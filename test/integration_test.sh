@@ -1,12 +1,17 @@
 #!/usr/bin/env bash
-# Integration test for interserve MCP server — extract_sections + codex_query validation
-# (classify_sections requires live Codex CLI, tested separately)
+# Integration test for interserve MCP server — extract_sections, classify_sections
+# (replayed from test/fixtures/replay, no live Codex CLI needed) + codex_query validation
 set -euo pipefail
 
 SCRIPT_DIR="$(cd "$(dirname "${BASH_SOURCE[0]}")" && pwd)"
 PLUGIN_ROOT="$(dirname "$SCRIPT_DIR")"
 BINARY="${PLUGIN_ROOT}/bin/interserve-mcp"
 
+# Serve dispatches from recorded fixtures. To re-record after a prompt change, run
+# against a live backend with INTERSERVE_RECORD_DIR="$SCRIPT_DIR/fixtures/replay".
+export INTERSERVE_BACKEND=replay
+export INTERSERVE_REPLAY_DIR="${SCRIPT_DIR}/fixtures/replay"
+
 echo "=== Building interserve-mcp ==="
 cd "$PLUGIN_ROOT"
 go build -o "$BINARY" ./cmd/interserve-mcp/
@@ -96,8 +101,72 @@ if echo "$HEADINGS" | grep -qi "title\|frontmatter"; then
     exit 1
 fi
 
+echo "=== Testing extract_sections heading tree ==="
+TREE_REQUEST='{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"extract_sections","arguments":{"file_path":"'"$TEST_DOC"'","min_level":1,"tree":true}}}'
+TREE_SHAPE=$(printf '%s\n%s\n%s\n' "$INIT" "$INITIALIZED" "$TREE_REQUEST" | "$BINARY" 2>/dev/null | tail -1 | python3 -c "
+import json,sys
+r = json.loads(sys.stdin.read())
+nodes = json.loads(r['result']['content'][0]['text'])
+print(' '.join('%s:%d' % (n['heading'], len(n['children'])) for n in nodes))
+")
+if [[ "$TREE_SHAPE" != "Main Title:4" ]]; then
+    echo "FAIL: expected one h1 node with 4 ## children, got $TREE_SHAPE"
+    rm "$TEST_DOC"
+    exit 1
+fi
+echo "extract_sections tree: PASS"
+
+echo "=== Testing get_sections ==="
+GET_REQUEST='{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"get_sections","arguments":{"file_path":"'"$TEST_DOC"'","sections":["security",5],"context":["performance"]}}}'
+GET_SHAPE=$(printf '%s\n%s\n%s\n' "$INIT" "$INITIALIZED" "$GET_REQUEST" | "$BINARY" 2>/dev/null | tail -1 | python3 -c "
+import json,sys
+r = json.loads(sys.stdin.read())
+result = json.loads(r['result']['content'][0]['text'])
+print(' '.join(s['heading'] for s in result['sections']), '|', result['context'][0]['stable_id'], '|', 'Token validation.' in result['sections'][0]['body'])
+")
+if [[ "$GET_SHAPE" != "Security Correctness | performance | True" ]]; then
+    echo "FAIL: get_sections returned $GET_SHAPE"
+    rm "$TEST_DOC"
+    exit 1
+fi
+echo "get_sections: PASS"
+
+echo "=== Testing classify_sections via replayed dispatch ==="
+CLASSIFY_REQUEST='{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"classify_sections","arguments":{"file_path":"'"$TEST_DOC"'","render":"inline"}}}'
+
+CLASSIFY_RESPONSE=$(printf '%s\n%s\n%s\n' "$INIT" "$INITIALIZED" "$CLASSIFY_REQUEST" | "$BINARY" 2>/dev/null | tail -1)
+
+CLASSIFY_RESULT=$(echo "$CLASSIFY_RESPONSE" | python3 -c "
+import json,sys
+r = json.loads(sys.stdin.read())
+result = json.loads(r['result']['content'][0]['text'])
+print(result.get('status', ''))
+print(result['slicing_map'].get('fd-safety', {}).get('priority_sections'))
+print(result.get('error', ''))
+print('## Security' in result.get('documents', {}).get('fd-safety', ''))
+")
+CLASSIFY_STATUS=$(echo "$CLASSIFY_RESULT" | sed -n 1p)
+SAFETY_PRIORITY=$(echo "$CLASSIFY_RESULT" | sed -n 2p)
+
+if [[ "$CLASSIFY_STATUS" != "success" ]]; then
+    echo "FAIL: classify_sections should succeed from fixtures, got $CLASSIFY_STATUS: $(echo "$CLASSIFY_RESULT" | sed -n 3p)"
+    rm "$TEST_DOC"
+    exit 1
+fi
+if [[ "$SAFETY_PRIORITY" != "[2]" ]]; then
+    echo "FAIL: fd-safety should get the Security section as priority, got $SAFETY_PRIORITY"
+    rm "$TEST_DOC"
+    exit 1
+fi
+if [[ "$(echo "$CLASSIFY_RESULT" | sed -n 4p)" != "True" ]]; then
+    echo "FAIL: fd-safety's rendered document should contain the Security section"
+    rm "$TEST_DOC"
+    exit 1
+fi
+echo "classify_sections replay: PASS"
+
 echo "=== Testing codex_query tool registration ==="
-# codex_query requires dispatch.sh (Codex) so we test input validation only
+# codex_query prompts embed temp file paths, so we test input validation only
 # Send a request with no files — should get an error back
 QUERY_REQUEST='{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"codex_query","arguments":{"question":"What does this do?","files":[],"mode":"answer"}}}'
 